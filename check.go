@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/webhook"
+	"gopkg.in/yaml.v2"
+)
+
+// checkConfig validates the config file and prints all the errors found to
+// stderr, it returns the exit code of the check-config command.
+func checkConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(stderr, "usage: json_exporter check-config <file>\n")
+		return 2
+	}
+	path := args[0]
+
+	// syntax errors are reported once instead of by both collectors and webhooks
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "FAILED: unable to read config file:%s err:%s\n", path, err)
+		return 1
+	}
+	if err := yaml.Unmarshal(data, &yaml.MapSlice{}); err != nil {
+		fmt.Fprintf(stderr, "FAILED: unable to parse config file:%s err:%s\n", path, err)
+		return 1
+	}
+
+	collectors, errs := collector.CheckConfig(path)
+	errs = append(errs, webhook.CheckConfig(path, collectors)...)
+
+	// errors of the shared top-level config are reported by both
+	seen := make(map[string]bool)
+	errs = slices.DeleteFunc(errs, func(err error) bool {
+		dup := seen[err.Error()]
+		seen[err.Error()] = true
+		return dup
+	})
+
+	if len(errs) == 0 {
+		fmt.Fprintf(stdout, "SUCCESS: config file:%s is valid\n", path)
+		return 0
+	}
+
+	for _, err := range errs {
+		fmt.Fprintf(stderr, "  %s\n", err)
+	}
+	fmt.Fprintf(stderr, "FAILED: config file:%s has %d error(s)\n", path, len(errs))
+	return 1
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_checkConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(name, config string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := writeConfig("valid.yaml", `
+collectors:
+  example:
+    namespace: test
+    metrics:
+      - name: events_total
+        path: .[]
+webhooks:
+  example:
+    method: POST
+    path: /events
+    collectors:
+      - id: example
+`)
+	// env variables of the deployment are not set in CI, rest of the errors
+	// must still be reported
+	invalid := writeConfig("invalid.yaml", `
+variables:
+  - name: cluster
+    valueFromEnv: TEST_CHECK_CONFIG_UNSET
+collectors:
+  example:
+    namespace: test
+    defaultLabels:
+      - name: cluster
+        value: $cluster
+    metrics:
+      - name: events_total
+        path: .[
+      - name: value_count
+        path: .foo |
+        labels:
+          - name: app-name
+            value: .app
+webhooks:
+  example:
+    method: POST
+    path: /events
+    collectors:
+      - id: example
+        transform: .events[
+      - id: missing
+`)
+	syntax := writeConfig("syntax.yaml", "collectors: [")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"usage", nil, 2, "", "usage: json_exporter check-config <file>\n"},
+		{"valid", []string{valid}, 0, "SUCCESS: config file:" + valid + " is valid\n", ""},
+		{"missing", []string{filepath.Join(dir, "missing.yaml")}, 1, "",
+			"FAILED: unable to read config file:" + filepath.Join(dir, "missing.yaml") +
+				" err:open " + filepath.Join(dir, "missing.yaml") + ": no such file or directory\n"},
+		{"syntax", []string{syntax}, 1, "",
+			"FAILED: unable to parse config file:" + syntax + " err:yaml: line 1: did not find expected node content\n"},
+		{"invalid", []string{invalid}, 1, "", `  invalid metric config collector:example metric:value_count err:invalid label name:"app-name"
+  invalid jq config err:unable to get value of variable:cluster err:env variable not set env:TEST_CHECK_CONFIG_UNSET
+  invalid jq expression collector:example location:metrics[events_total].path err:jq query parse error unexpected EOF
+  invalid jq expression collector:example location:metrics[value_count].path err:jq query parse error unexpected EOF
+  unknown collector webhook:example collector:missing
+  invalid jq expression webhook:example location:collectors[example].transform err:jq query parse error unexpected EOF
+FAILED: config file:` + invalid + " has 6 error(s)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := checkConfig(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("checkConfig() code = %v, want %v", code, tt.wantCode)
+			}
+			if diff := cmp.Diff(tt.wantStdout, stdout.String()); diff != "" {
+				t.Errorf("checkConfig() stdout mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantStderr, stderr.String()); diff != "" {
+				t.Errorf("checkConfig() stderr mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/utilitywarehouse/json_exporter/jq"
+	"gopkg.in/yaml.v2"
+)
+
+// CheckConfig validates the collectors of the config and compiles all of
+// their jq expressions. unlike Load it doesn't stop at the first error, all
+// the errors found are returned along with the ids of the collectors.
+func CheckConfig(configPath string) ([]string, []error) {
+	var config Config
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, []error{err}
+	}
+
+	errs := configErrors(config)
+	ids := slices.Sorted(maps.Keys(config.Collectors))
+
+	// expressions are only checked if definitions and variables are valid,
+	// variables whose values can't be read are reported and a placeholder is used
+	jqc, jqErrs := jq.CheckCompiler(config.JQ, config.Variables, filepath.Dir(configPath))
+	for _, err := range jqErrs {
+		errs = append(errs, fmt.Errorf("invalid jq config err:%w", err))
+	}
+	if jqc == nil {
+		return ids, errs
+	}
+
+	for _, id := range ids {
+		if c := config.Collectors[id]; c != nil {
+			errs = append(errs, expressionErrors(id, c, jqc)...)
+		}
+	}
+
+	return ids, errs
+}
+
+// expression is a jq expression of the config and its location
+type expression struct {
+	location string
+	exp      string
+}
+
+// expressionErrors compiles all the jq expressions of the collector and
+// returns the errors
+func expressionErrors(id string, c *Collector, jqc *jq.Compiler) []error {
+	var exps []expression
+
+	if c.OrderingKey != "" {
+		exps = append(exps, expression{"orderingKey", c.OrderingKey})
+	}
+	if c.Dedup != nil && c.Dedup.Key != "" {
+		exps = append(exps, expression{"dedup.key", c.Dedup.Key})
+	}
+	for _, l := range c.DefaultLabels {
+		exps = append(exps, expression{fmt.Sprintf("defaultLabels[%s].value", l.Name), l.Value})
+	}
+
+	for _, m := range c.Metrics {
+		if m == nil {
+			continue
+		}
+		prefix := fmt.Sprintf("metrics[%s].", m.Name)
+		exps = append(exps,
+			expression{prefix + "path", m.Path},
+			expression{prefix + "filter", m.Filter},
+			expression{prefix + "value", m.Value},
+			expression{prefix + "timestamp", m.Timestamp},
+			expression{prefix + "nameFrom", m.NameFrom},
+			expression{prefix + "labelsFrom", m.LabelsFrom},
+		)
+		for _, l := range m.Labels {
+			exps = append(exps, expression{fmt.Sprintf("%slabels[%s].value", prefix, l.Name), l.Value})
+		}
+	}
+
+	var errs []error
+	for _, e := range exps {
+		if e.exp == "" {
+			continue
+		}
+		if _, err := jqc.Compile(e.exp); err != nil {
+			errs = append(errs, fmt.Errorf("invalid jq expression collector:%s location:%s err:%w", id, e.location, err))
+		}
+	}
+	return errs
+}
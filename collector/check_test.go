@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	// env variables of the deployment are not set when config is checked in CI
+	config := `
+variables:
+  - name: cluster
+    valueFromEnv: TEST_CHECK_UNSET
+collectors:
+  valid:
+    namespace: valid
+    defaultLabels:
+      - name: cluster
+        value: $cluster
+    metrics:
+      - name: events_total
+        path: .[]
+  invalid:
+    namespace: invalid
+    defaultLabels:
+      - name: app
+        value: .app | foo
+    metrics:
+      - name: events_total
+        path: .[
+        labels:
+          - name: app-name
+            value: .name
+      - name: events_total
+        filter: .a ==
+      - name: status
+        type: stateset
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("unable to write config err:%v", err)
+	}
+
+	ids, errs := CheckConfig(path)
+
+	if diff := cmp.Diff(ids, []string{"invalid", "valid"}); diff != "" {
+		t.Errorf("CheckConfig() ids mismatch (-want +got):\n%s", diff)
+	}
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	expected := []string{
+		`invalid metric config collector:invalid metric:events_total err:invalid label name:"app-name"`,
+		`metrics name must be unique duplicate names found collector:invalid namespace:invalid metric:events_total`,
+		`invalid metric config collector:invalid metric:status err:states are required for stateset metrics`,
+		`invalid jq config err:unable to get value of variable:cluster err:env variable not set env:TEST_CHECK_UNSET`,
+		`invalid jq expression collector:invalid location:defaultLabels[app].value err:jq query compile error function not defined: foo/0`,
+		`invalid jq expression collector:invalid location:metrics[events_total].path err:jq query parse error unexpected EOF`,
+		`invalid jq expression collector:invalid location:metrics[events_total].filter err:jq query parse error unexpected EOF`,
+	}
+	if diff := cmp.Diff(got, expected); diff != "" {
+		t.Errorf("CheckConfig() errors mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -4,73 +4,234 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/itchyny/gojq"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/dedup"
+	"github.com/utilitywarehouse/json_exporter/jq"
 )
 
 type JSONCollector struct {
 	id      string
-	Input   chan any
+	Input   chan queuedInput
 	log     *slog.Logger
+	reg     *prometheus.Registry
 	metrics []*jsonMetric
+
+	// sweepInterval is the interval of removing expired series
+	// its 0 if none of the metrics has ttl set
+	sweepInterval time.Duration
+
+	workers     int
+	ordering    Ordering
+	orderingKey *jq.Code
+
+	queuePolicy           QueuePolicy
+	queueRejectStatusCode int
+
+	timeout         time.Duration
+	onError         ErrorPolicy
+	onNullIteration NullIterationPolicy
+
+	// dedup is only set if inputs of the collector are deduplicated
+	dedup *dedup.Deduplicator
+	// dedupFingerprint is the config of dedup, used to reuse dedup on reload
+	dedupFingerprint string
+
+	// stop is closed to stop the collector and stopped is closed once its stopped
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
 }
 
+// jsonMetric implements prometheus.Collector and exposes all the series
+// collected from the json objects.
 type jsonMetric struct {
-	name   string
-	path   *gojq.Code
-	filter *gojq.Code
-	value  *gojq.Code
-	labels []jsonLabel
+	name      string
+	collector string
+	// fingerprint is the config of the metric, used to find unchanged metrics on reload
+	fingerprint string
+	desc        *prometheus.Desc
+	path        *jq.Code
+	filter      *jq.Code
+	value       *jq.Code
+	timestamp   *jq.Code
+	labels      []jsonLabel
+	// relabelers of the collector followed by relabelers of the metric
+	relabelers []relabeler
+
+	// dynamic is only set if metric names are taken from the json objects
+	dynamic *dynamicMetrics
+	// dynamicLabels is only set if labels are taken from the json objects
+	dynamicLabels *dynamicLabels
 
 	metricType MetricType
 	operation  MetricOperation
+	aggregate  Aggregation
+	states     []string
+	ttl        time.Duration
+
+	maxSeries     int
+	overflow      OverflowAction
+	overflowValue string
+
+	maxLabelCombinations int
 
-	pCounterVec *prometheus.CounterVec
-	pGaugeVec   *prometheus.GaugeVec
+	fqName string
+	help   string
+	series *seriesStore
+
+	// histogram and summary vectors by label names of the series. vectors are
+	// not registered, they are only used to create observers of the series
+	histogramOpts prometheus.HistogramOpts
+	summaryOpts   prometheus.SummaryOpts
+	observerVecs  map[string]observerVec
+}
+
+// observerVec is implemented by both HistogramVec and SummaryVec
+type observerVec interface {
+	With(prometheus.Labels) prometheus.Observer
+	Delete(prometheus.Labels) bool
 }
 
 type jsonLabel struct {
-	name  string
-	value *gojq.Code
+	name   string
+	value  *jq.Code
+	expand bool
 }
 
+// New loads the collectors of the config, metrics of the collectors and
+// exporter's own metrics are registered to reg.
 func New(configPath string, reg *prometheus.Registry, log *slog.Logger, exporterNamespace string) (map[string]*JSONCollector, error) {
+	jsonCollectors, err := Load(configPath, reg, log, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	InitMetrics(reg, exporterNamespace)
+
+	return jsonCollectors, nil
+}
+
+// Load loads the collectors of the config and registers their metrics to reg.
+// metrics of the previous collectors whose config is unchanged are reused so
+// their series are kept. on reload reg should be a new registry as registry
+// doesn't allow re-registering a metric name with different labels.
+// exporter's own metrics must be initialised with InitMetrics.
+func Load(configPath string, reg *prometheus.Registry, log *slog.Logger, previous map[string]*JSONCollector) (map[string]*JSONCollector, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load collectors err:%w", err)
+	}
+	return LoadData(data, filepath.Dir(configPath), reg, log, previous)
+}
+
+// LoadData is like Load but it loads the collectors of the config content,
+// dir is the directory of the config file.
+func LoadData(data []byte, dir string, reg *prometheus.Registry, log *slog.Logger, previous map[string]*JSONCollector) (map[string]*JSONCollector, error) {
 	jsonCollectors := make(map[string]*JSONCollector)
 
-	collectors, err := loadCollectors(configPath)
+	collectors, err := loadCollectors(data, dir)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load collectors err:%w", err)
 	}
 
 	for id, collector := range collectors {
-		js, err := jsonCollector(collector, reg, log.With("collector", id))
+		js, err := newJSONCollector(collector, reg, log.With("collector", id), previous[id])
 		if err != nil {
 			return nil, fmt.Errorf("unable to create collector err:%w", err)
 		}
 		jsonCollectors[id] = js
 	}
 
-	initMetrics(reg, exporterNamespace)
-
 	return jsonCollectors, nil
 }
 
-func jsonCollector(collector *Collector, reg *prometheus.Registry, log *slog.Logger) (*JSONCollector, error) {
+// newJSONCollector creates the collector of the config, state of the previous
+// collector with the same id is reused where config is unchanged.
+func newJSONCollector(collector *Collector, reg *prometheus.Registry, log *slog.Logger, previous *JSONCollector) (*JSONCollector, error) {
 	jsonCollector := JSONCollector{
-		id:    collector.id,
-		log:   log,
-		Input: make(chan any),
+		id:       collector.id,
+		log:      log,
+		reg:      reg,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		workers:  collector.Workers,
+		ordering: collector.Ordering,
+
+		queuePolicy:           collector.Queue.Policy,
+		queueRejectStatusCode: collector.Queue.RejectStatusCode,
+
+		timeout:         collector.Timeout,
+		onError:         collector.OnError,
+		onNullIteration: collector.OnNullIteration,
+	}
+
+	if jsonCollector.timeout == 0 {
+		jsonCollector.timeout = defaultTimeout
+	}
+	if jsonCollector.onError == "" {
+		jsonCollector.onError = OnErrorSkipMetric
+	}
+	if jsonCollector.onNullIteration == "" {
+		jsonCollector.onNullIteration = NullIterationIgnore
+	}
+
+	queueSize := collector.Queue.Size
+	if queueSize == 0 {
+		queueSize = defaultQueueSize
+	}
+	jsonCollector.Input = make(chan queuedInput, queueSize)
+
+	if jsonCollector.queuePolicy == "" {
+		jsonCollector.queuePolicy = QueueBlock
+	}
+	if jsonCollector.queueRejectStatusCode == 0 {
+		jsonCollector.queueRejectStatusCode = defaultQueueRejectStatusCode
+	}
+
+	switch {
+	case jsonCollector.ordering == OrderingStrict:
+		jsonCollector.workers = 1
+	case jsonCollector.workers == 0:
+		jsonCollector.workers = defaultWorkers
+	}
+
+	if collector.Dedup != nil {
+		jsonCollector.dedupFingerprint = dedup.Fingerprint(*collector.Dedup, collector.compiler())
+		// seen keys are kept on reload if dedup config is unchanged
+		if previous != nil && previous.dedup != nil && jsonCollector.dedupFingerprint != "" &&
+			previous.dedupFingerprint == jsonCollector.dedupFingerprint {
+			jsonCollector.dedup = previous.dedup
+		} else {
+			code, err := collector.compiler().Compile(collector.Dedup.Key)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse dedup key expression err:%w", err)
+			}
+			jsonCollector.dedup = dedup.New(*collector.Dedup, code)
+		}
+	}
+
+	if jsonCollector.ordering == OrderingPerKey {
+		code, err := collector.compiler().Compile(collector.OrderingKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ordering key expression err:%w", err)
+		}
+		jsonCollector.orderingKey = code
 	}
 
 	var defaultLabels []jsonLabel
 
 	// parse default labels
 	for _, lc := range collector.DefaultLabels {
-		l := jsonLabel{name: lc.Name}
-		code, err := parseAndCompileJQExp(lc.Value)
+		l := jsonLabel{name: lc.Name, expand: lc.Expand}
+		code, err := collector.compiler().Compile(lc.Value)
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse default label expression name:%s err:%w", lc.Name, err)
 		}
@@ -80,47 +241,83 @@ func jsonCollector(collector *Collector, reg *prometheus.Registry, log *slog.Log
 	}
 
 	for _, m := range collector.Metrics {
-		jm, err := newJsonMetric(m, reg, collector.Namespace, defaultLabels)
+		jm, err := previous.reuseMetric(m, reg, collector)
+		if err == nil && jm == nil {
+			jm, err = newJsonMetric(m, reg, collector, defaultLabels)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("unable to create json metrics err:%w", err)
 		}
 		jsonCollector.metrics = append(jsonCollector.metrics, jm)
+
+		// sweep at half of the smallest ttl so series are removed in time
+		if jm.ttl > 0 && (jsonCollector.sweepInterval == 0 || jm.ttl/2 < jsonCollector.sweepInterval) {
+			jsonCollector.sweepInterval = jm.ttl / 2
+		}
 	}
 	return &jsonCollector, nil
 }
 
-func newJsonMetric(metric *Metric, reg *prometheus.Registry, ns string, defaultLabels []jsonLabel) (*jsonMetric, error) {
+func newJsonMetric(metric *Metric, reg *prometheus.Registry, collector *Collector, defaultLabels []jsonLabel) (*jsonMetric, error) {
 	var err error
 
 	if metric == nil {
 		return nil, fmt.Errorf("metric is required")
 	}
 
-	*metric = setDefaults(*metric)
+	*metric = setDefaults(setCollectorDefaults(collector, *metric))
 
-	jm := &jsonMetric{name: metric.Name, metricType: metric.Type, operation: metric.Operation}
+	ns := collector.Namespace
 
-	jm.path, err = parseAndCompileJQExp(metric.Path)
+	jm := &jsonMetric{
+		name:          metric.Name,
+		collector:     collector.id,
+		fingerprint:   fingerprint(collector, metric),
+		metricType:    metric.Type,
+		operation:     metric.Operation,
+		aggregate:     metric.Aggregate,
+		states:        metric.States,
+		ttl:           metric.TTL,
+		maxSeries:     metric.MaxSeries,
+		overflow:      metric.Overflow,
+		overflowValue: metric.OverflowValue,
+
+		maxLabelCombinations: metric.MaxLabelCombinations,
+	}
+
+	jm.path, err = collector.compiler().Compile(metric.Path)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse path expression metric:%s err:%w", metric.Name, err)
 	}
 
-	jm.filter, err = parseAndCompileJQExp(metric.Filter)
+	jm.filter, err = collector.compiler().Compile(metric.Filter)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse filter expression metric:%s err:%w", metric.Name, err)
 	}
 
-	jm.value, err = parseAndCompileJQExp(metric.Value)
+	jm.value, err = collector.compiler().Compile(metric.Value)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse value expression metric:%s err:%w", metric.Name, err)
 	}
 
+	if metric.Timestamp != "" {
+		jm.timestamp, err = collector.compiler().Compile(metric.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse timestamp expression metric:%s err:%w", metric.Name, err)
+		}
+	}
+
 	jm.labels = append(jm.labels, defaultLabels...)
 
+	jm.relabelers, err = newRelabelers(slices.Concat(collector.RelabelConfigs, metric.RelabelConfigs))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create relabelers metric:%s err:%w", metric.Name, err)
+	}
+
 	// parse metric labels
 	for _, mcl := range metric.Labels {
-		l := jsonLabel{name: mcl.Name}
-		code, err := parseAndCompileJQExp(mcl.Value)
+		l := jsonLabel{name: mcl.Name, expand: mcl.Expand}
+		code, err := collector.compiler().Compile(mcl.Value)
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse label expression metric:%s name:%s err:%w",
 				metric.Name, mcl.Name, err)
@@ -130,61 +327,267 @@ func newJsonMetric(metric *Metric, reg *prometheus.Registry, ns string, defaultL
 		jm.labels = append(jm.labels, l)
 	}
 
+	if metric.LabelsFrom != "" {
+		jm.dynamicLabels, err = newDynamicLabels(metric, collector.compiler())
+		if err != nil {
+			return nil, fmt.Errorf("unable to create dynamic labels metric:%s err:%w", metric.Name, err)
+		}
+	}
+
+	if metric.NameFrom != "" {
+		// metrics are created when names are known
+		jm.dynamic, err = newDynamicMetrics(metric, reg, ns, collector.compiler())
+		if err != nil {
+			return nil, fmt.Errorf("unable to create dynamic metrics metric:%s err:%w", metric.Name, err)
+		}
+		return jm, nil
+	}
+
+	if err := jm.init(metric, ns, metric.Name); err != nil {
+		return nil, err
+	}
+	if err := reg.Register(jm); err != nil {
+		return nil, fmt.Errorf("unable to register metric:%s err:%w", metric.Name, err)
+	}
+
+	return jm, nil
+}
+
+// reuseMetric returns the metric of the previous collector with the same
+// config after registering it to reg, nil is returned if there is none.
+func (jc *JSONCollector) reuseMetric(metric *Metric, reg *prometheus.Registry, collector *Collector) (*jsonMetric, error) {
+	if jc == nil || metric == nil {
+		return nil, nil
+	}
+
+	m := setDefaults(setCollectorDefaults(collector, *metric))
+	fp := fingerprint(collector, &m)
+	if fp == "" {
+		return nil, nil
+	}
+
+	for _, jm := range jc.metrics {
+		if jm.fingerprint != fp {
+			continue
+		}
+		// dynamic metrics are registered once collector is started
+		if jm.dynamic == nil {
+			if err := reg.Register(jm); err != nil {
+				return nil, fmt.Errorf("unable to register metric:%s err:%w", metric.Name, err)
+			}
+		}
+		return jm, nil
+	}
+	return nil, nil
+}
+
+// activate registers dynamic metrics of the collector to collector's registry.
+// dynamic metrics are shared with the previous collector on reload so its
+// only done once the collector is started.
+func (jc *JSONCollector) activate() {
+	for _, jm := range jc.metrics {
+		if jm.dynamic == nil {
+			continue
+		}
+		if failed := jm.dynamic.activate(jc.reg); failed > 0 {
+			jc.log.Error("unable to register dynamic metrics", "metric", jm.name, "count", failed)
+		}
+	}
+}
+
+// init creates series store and descriptor of the metric with given name
+func (jm *jsonMetric) init(metric *Metric, ns, name string) error {
+	jm.name = name
+	jm.fqName = prometheus.BuildFQName(ns, "", name)
+	jm.help = metric.Help
+	jm.series = newSeriesStore(getLabelNames(jm.labels))
+	jm.observerVecs = make(map[string]observerVec)
+
+	labelNames := getLabelNames(jm.labels)
+
 	switch metric.Type {
 
-	case CounterMetric:
-		jm.pCounterVec = prometheus.NewCounterVec(
-			prometheus.CounterOpts{Namespace: ns, Name: metric.Name, Help: metric.Help},
-			getLabelNames(jm.labels),
-		)
-		reg.MustRegister(jm.pCounterVec)
-
-	case GaugeMetric:
-		jm.pGaugeVec = prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{Namespace: ns, Name: metric.Name, Help: metric.Help},
-			getLabelNames(jm.labels),
-		)
-		reg.MustRegister(jm.pGaugeVec)
+	case CounterMetric, GaugeMetric, InfoMetric:
+
+	case HistogramMetric:
+		jm.histogramOpts = prometheus.HistogramOpts{
+			Namespace: ns, Name: name, Help: metric.Help,
+			Buckets: metric.histogramBuckets(),
+
+			NativeHistogramBucketFactor:    metric.NativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber: metric.NativeHistogramMaxBucketNumber,
+			NativeHistogramZeroThreshold:   metric.NativeHistogramZeroThreshold,
+		}
+
+	case SummaryMetric:
+		jm.summaryOpts = prometheus.SummaryOpts{
+			Namespace: ns, Name: name, Help: metric.Help,
+			Objectives: metric.Objectives,
+			MaxAge:     metric.MaxAge,
+			AgeBuckets: metric.AgeBuckets,
+		}
+
+	case StateSetMetric:
+		// state is exposed as a label with the name of the metric
+		labelNames = append(labelNames, name)
 
 	default:
-		return nil, fmt.Errorf("unknown metric type")
+		return fmt.Errorf("unknown metric type")
 	}
 
-	return jm, nil
+	jm.desc = prometheus.NewDesc(jm.fqName, jm.help, labelNames, nil)
+
+	return nil
 }
 
-// Start runs a continuous loop that starts a new collection when a input payload comes into the queue channel.
+// Describe implements prometheus.Collector
+func (jm *jsonMetric) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jm.desc
+}
+
+// Collect implements prometheus.Collector
+func (jm *jsonMetric) Collect(ch chan<- prometheus.Metric) {
+	jm.series.each(func(s *series) {
+		for _, m := range jm.seriesMetrics(s) {
+			if !s.timestamp.IsZero() {
+				m = prometheus.NewMetricWithTimestamp(s.timestamp, m)
+			}
+			ch <- m
+		}
+	})
+}
+
+// seriesDesc returns descriptor of the series, series with dynamic or
+// relabeled labels have their own descriptor as label names differ from the
+// metric's descriptor.
+func (jm *jsonMetric) seriesDesc(s *series) *prometheus.Desc {
+	if slices.Equal(s.labelNames, jm.series.names) {
+		return jm.desc
+	}
+
+	if s.desc == nil {
+		labelNames := s.labelNames
+		if jm.metricType == StateSetMetric {
+			labelNames = append(slices.Clone(labelNames), jm.name)
+		}
+		s.desc = prometheus.NewDesc(jm.fqName, jm.help, labelNames, nil)
+	}
+	return s.desc
+}
+
+// seriesMetrics returns prometheus metrics of the series
+func (jm *jsonMetric) seriesMetrics(s *series) []prometheus.Metric {
+	var metrics []prometheus.Metric
+
+	desc := jm.seriesDesc(s)
+
+	newMetric := func(m prometheus.Metric, err error) {
+		if err != nil {
+			m = prometheus.NewInvalidMetric(desc, err)
+		}
+		metrics = append(metrics, m)
+	}
+
+	switch jm.metricType {
+
+	case CounterMetric:
+		newMetric(prometheus.NewConstMetricWithCreatedTimestamp(
+			desc, prometheus.CounterValue, s.value, s.created, s.labelValues...))
+
+	case GaugeMetric, InfoMetric:
+		newMetric(prometheus.NewConstMetric(
+			desc, prometheus.GaugeValue, s.value, s.labelValues...))
+
+	case StateSetMetric:
+		for _, state := range jm.states {
+			var v float64
+			if state == s.state {
+				v = 1
+			}
+			newMetric(prometheus.NewConstMetric(
+				desc, prometheus.GaugeValue, v, append(slices.Clone(s.labelValues), state)...))
+		}
+
+	case HistogramMetric, SummaryMetric:
+		if m, ok := s.observer.(prometheus.Metric); ok {
+			metrics = append(metrics, m)
+		}
+	}
+
+	return metrics
+}
+
+// Start runs a continuous loop that dispatches input payloads of the queue
+// channel to the workers of the collector until context is cancelled or
+// collector is stopped.
 func (jc *JSONCollector) Start(ctx context.Context) {
+	defer close(jc.stopped)
+
+	jc.activate()
+
 	wg := &sync.WaitGroup{}
 
+	// workers are stopped separately so that inputs being processed are not
+	// cancelled when collector is stopped
+	wCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	queues := jc.startWorkers(ctx, wCtx, wg)
+
+	var sweep <-chan time.Time
+	if jc.sweepInterval > 0 {
+		ticker := time.NewTicker(jc.sweepInterval)
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			// wait for all run to finish
+			// wait for all workers to finish
 			wg.Wait()
 			return
 
-		case input := <-jc.Input:
-			wg.Add(1)
-			go func(input any) {
-				defer wg.Done()
-				// create new context for worker
-				wCtx, wCancel := context.WithTimeout(ctx, time.Minute)
-				defer wCancel()
+		case <-jc.stop:
+			// workers process inputs already in their queues before returning
+			jc.drain(ctx, queues)
+			for _, q := range queues {
+				close(q)
+			}
+			wg.Wait()
+			return
 
-				start := time.Now()
+		case now := <-sweep:
+			expired := jc.expireSeries(now)
+			cmu.updateExpiredSeries(jc.id, expired)
+			if expired > 0 {
+				jc.log.Debug("expired series removed", "count", expired)
+			}
 
-				success := jc.process(wCtx, input)
+		case q := <-jc.Input:
+			cmu.updateQueueDepth(jc.id, len(jc.Input))
+			jc.dispatch(ctx, queues, q)
+		}
+	}
+}
 
-				cmu.updateCollectorSuccess(jc.id, success)
-				cmu.updateCollectorDuration(jc.id, time.Since(start).Seconds(), success)
+// Stop processes all the queued inputs and stops the collector started by
+// Start, it returns once collector is stopped. inputs must not be sent to
+// the collector after Stop is called.
+func (jc *JSONCollector) Stop() {
+	jc.stopOnce.Do(func() { close(jc.stop) })
+	<-jc.stopped
+}
 
-				if success {
-					jc.log.Debug("metrics collection completed successfully")
-				} else {
-					jc.log.Error("metrics collection completed with error")
-				}
-			}(input)
+// drain dispatches all the queued inputs to the workers
+func (jc *JSONCollector) drain(ctx context.Context, queues []chan queuedInput) {
+	for {
+		select {
+		case q := <-jc.Input:
+			cmu.updateQueueDepth(jc.id, len(jc.Input))
+			jc.dispatch(ctx, queues, q)
+		default:
+			return
 		}
 	}
 }
@@ -192,98 +595,432 @@ func (jc *JSONCollector) Start(ctx context.Context) {
 func (jc *JSONCollector) process(ctx context.Context, input any) bool {
 	success := true
 	for _, metric := range jc.metrics {
-		iter := metric.path.RunWithContext(ctx, input)
-		for {
-			object, ok := iter.Next()
-			if !ok {
-				break
-			}
+		ok, abort := jc.processMetric(ctx, metric, input)
+		if !ok {
+			success = false
+		}
+		if abort {
+			break
+		}
+	}
+	return success
+}
 
-			if err, ok := object.(error); ok {
-				if err.Error() == "cannot iterate over: null" {
-					break
+// processMetric collects the metric from all the json objects of the input.
+// it returns false if there was any error and abort is true if rest of the
+// payload should not be processed as per the error policy.
+func (jc *JSONCollector) processMetric(ctx context.Context, metric *jsonMetric, input any) (success, abort bool) {
+	success = true
+
+	iter := metric.path.RunWithContext(ctx, input)
+	for {
+		object, ok := iter.Next()
+		if !ok {
+			return success, false
+		}
+
+		var err error
+		if pErr, ok := object.(error); ok {
+			err = &collectError{class: errClassPath, err: pErr}
+			if isNullIteration(pErr) {
+				if jc.onNullIteration == NullIterationIgnore {
+					return success, false
 				}
-				// todo: should we filter this out?
-				// if strings.Contains(err.Error(), "expected an object but got: array") {
-				// 	break
-				// }
-
-				jc.log.Error("unable to get json objects", "metric", metric.name, "err", err)
-				success = false
-				break
+				err = &collectError{class: errClassNullIteration, err: pErr}
 			}
+		} else {
+			err = metric.collect(ctx, object)
+		}
 
-			if err := metric.collect(ctx, object); err != nil {
-				jc.log.Error("unable to collect", "metric", metric.name, "err", err)
-				success = false
-				break
-			}
+		if err == nil {
+			continue
+		}
+
+		class := errorClass(err)
+		cmu.updateCollectionErrors(jc.id, metric.name, class)
+		jc.log.Error("unable to collect", "metric", metric.name, "class", class, "err", err)
+		success = false
+
+		if class == errClassTimeout || jc.onError == OnErrorAbort {
+			return false, true
+		}
+		if jc.onError == OnErrorSkipMetric {
+			return false, false
 		}
 	}
-	return success
 }
 
 func (jm *jsonMetric) collect(ctx context.Context, input any) error {
 	filter, err := extractFirstValue(ctx, jm.filter, input)
 	if err != nil {
-		return fmt.Errorf("unable to get filter value err:%w", err)
+		return &collectError{class: errClassFilter, err: fmt.Errorf("unable to get filter value err:%w", err)}
 	}
 
 	if filter == false {
 		return nil
 	}
 
-	labels, err := jm.extractLabels(ctx, input)
+	if jm.dynamic != nil {
+		target, err := jm.dynamicMetric(ctx, input)
+		if err != nil {
+			return &collectError{class: errClassName, err: err}
+		}
+		if target == nil {
+			return nil
+		}
+		jm = target
+	}
+
+	labelSets, err := jm.extractLabels(ctx, input)
 	if err != nil {
-		return err
+		return &collectError{class: errClassLabels, err: err}
 	}
 
-	value, err := extractFirstValue(ctx, jm.value, input)
+	labelSets, err = jm.relabel(labelSets)
 	if err != nil {
-		return fmt.Errorf("unable to get value err:%w", err)
+		return &collectError{class: errClassLabels, err: err}
+	}
+	if len(labelSets) == 0 {
+		return nil
 	}
 
-	v, err := sanitizeValue(value)
+	ts, err := jm.extractTimestamp(ctx, input)
 	if err != nil {
-		return fmt.Errorf("unable to sanitize value err:%w", err)
+		return &collectError{class: errClassTimestamp, err: err}
 	}
 
-	jm.updateValue(labels, v)
+	if jm.metricType == StateSetMetric {
+		value, err := extractFirstValue(ctx, jm.value, input)
+		if err != nil {
+			return &collectError{class: errClassValue, err: fmt.Errorf("unable to get value err:%w", err)}
+		}
+		for _, labels := range labelSets {
+			if err := jm.updateState(labels, fmt.Sprint(value), ts); err != nil {
+				return &collectError{class: errClassValue, err: err}
+			}
+		}
+		return nil
+	}
+
+	v, ok, err := jm.extractValue(ctx, input)
+	if err != nil {
+		return &collectError{class: errClassValue, err: err}
+	}
+	if !ok {
+		return nil
+	}
+
+	for _, labels := range labelSets {
+		if err := jm.updateValue(labels, v, ts); err != nil {
+			return &collectError{class: errClassValue, err: err}
+		}
+	}
 
 	return nil
 }
 
-func (jm *jsonMetric) extractLabels(ctx context.Context, input any) (prometheus.Labels, error) {
-	pLabels := prometheus.Labels{}
+// extractTimestamp returns sample timestamp of the input, zero time is returned
+// if timestamp expression is not set or results in null.
+func (jm *jsonMetric) extractTimestamp(ctx context.Context, input any) (time.Time, error) {
+	if jm.timestamp == nil {
+		return time.Time{}, nil
+	}
+
+	value, err := extractFirstValue(ctx, jm.timestamp, input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to get timestamp err:%w", err)
+	}
+
+	ts, err := parseTimestamp(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse timestamp err:%w", err)
+	}
+	return ts, nil
+}
+
+// extractValue returns value of the metric for the input after applying aggregation
+// on all outputs of the value expression. it returns false if there is no value
+// to update.
+func (jm *jsonMetric) extractValue(ctx context.Context, input any) (float64, bool, error) {
+	if jm.aggregate == AggregateFirst {
+		value, err := extractFirstValue(ctx, jm.value, input)
+		if err != nil {
+			return 0, false, fmt.Errorf("unable to get value err:%w", err)
+		}
+
+		v, err := sanitizeValue(value)
+		if err != nil {
+			return 0, false, fmt.Errorf("unable to sanitize value err:%w", err)
+		}
+		return v, true, nil
+	}
+
+	values, err := extractAllValues(ctx, jm.value, input)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to get values err:%w", err)
+	}
+
+	v, ok, err := aggregateValues(jm.aggregate, values)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to aggregate values aggregate:%s err:%w", jm.aggregate, err)
+	}
+	return v, ok, nil
+}
+
+// extractLabels returns label sets for the input. expand labels produce
+// a label set for each output of its expression, if there are multiple expand
+// labels cartesian product of all the outputs is returned.
+func (jm *jsonMetric) extractLabels(ctx context.Context, input any) ([]prometheus.Labels, error) {
+	labelSets := []prometheus.Labels{{}}
 
 	for _, label := range jm.labels {
-		v, err := extractFirstValue(ctx, label.value, input)
+		if !label.expand {
+			v, err := extractFirstValue(ctx, label.value, input)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get label value label:%s err:%w", label.name, err)
+			}
+			for _, pLabels := range labelSets {
+				pLabels[label.name] = fmt.Sprint(v)
+			}
+			continue
+		}
+
+		values, err := extractAllValues(ctx, label.value, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get label values label:%s err:%w", label.name, err)
+		}
+
+		if len(labelSets)*len(values) > jm.maxLabelCombinations {
+			return nil, fmt.Errorf("too many label combinations label:%s combinations:%d max:%d",
+				label.name, len(labelSets)*len(values), jm.maxLabelCombinations)
+		}
+
+		var expanded []prometheus.Labels
+		for _, pLabels := range labelSets {
+			for _, v := range values {
+				l := maps.Clone(pLabels)
+				l[label.name] = fmt.Sprint(v)
+				expanded = append(expanded, l)
+			}
+		}
+		labelSets = expanded
+	}
+
+	if jm.dynamicLabels != nil {
+		dLabels, err := jm.dynamicLabels.extract(ctx, input)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get label value label:%s err:%w", label.name, err)
+			return nil, err
+		}
+		for _, pLabels := range labelSets {
+			for name, value := range dLabels {
+				// configured labels take precedence
+				if _, ok := pLabels[name]; ok {
+					continue
+				}
+				pLabels[name] = value
+			}
 		}
-		pLabels[label.name] = fmt.Sprint(v)
 	}
 
-	return pLabels, nil
+	return labelSets, nil
 }
 
-func (jm *jsonMetric) updateValue(labels prometheus.Labels, v float64) {
-	switch jm.metricType {
+// relabel applies relabel configs to the label sets and returns the label sets
+// which are not dropped. labels reserved by the metric type must not be set.
+func (jm *jsonMetric) relabel(labelSets []prometheus.Labels) ([]prometheus.Labels, error) {
+	if len(jm.relabelers) == 0 {
+		return labelSets, nil
+	}
 
-	case CounterMetric:
-		jm.pCounterVec.With(labels).Add(v)
+	var relabeled []prometheus.Labels
+	for _, labels := range labelSets {
+		labels, keep := relabel(labels, jm.relabelers)
+		if !keep {
+			continue
+		}
+		for name := range labels {
+			if isReservedLabel(jm.metricType, jm.name, name) {
+				return nil, fmt.Errorf("relabeled label name is reserved for %s metrics label:%s", jm.metricType, name)
+			}
+		}
+		relabeled = append(relabeled, labels)
+	}
+	return relabeled, nil
+}
 
-	case GaugeMetric:
-		switch jm.operation {
-		case OperationAdd:
-			jm.pGaugeVec.With(labels).Add(v)
-		default:
-			jm.pGaugeVec.With(labels).Set(v)
+// expireSeries removes all the series of the metrics which are not updated
+// within metric's ttl and returns number of removed series.
+func (jc *JSONCollector) expireSeries(now time.Time) int {
+	var count int
+	for _, jm := range jc.metrics {
+		count += jm.expireSeries(now)
+	}
+	return count
+}
+
+// expireSeries removes all the series which are not updated within ttl
+// including series of the dynamic metrics.
+func (jm *jsonMetric) expireSeries(now time.Time) int {
+	if jm.ttl <= 0 {
+		return 0
+	}
+
+	if jm.dynamic != nil {
+		var count int
+		for _, dm := range jm.dynamic.all() {
+			count += dm.expireSeries(now)
+		}
+		return count
+	}
+
+	return jm.series.expire(now.Add(-jm.ttl), jm.deleteSeries)
+}
+
+// updateSeries calls updateFn with the series of the label set after applying
+// series limit. updateFn is not called if the sample is dropped.
+func (jm *jsonMetric) updateSeries(labels prometheus.Labels, updateFn func(*series)) {
+	now := time.Now()
+
+	if jm.series.update(labels, now, jm.maxSeries, updateFn) {
+		return
+	}
+
+	if jm.overflow == OverflowFold {
+		// dynamic labels are not part of the overflow series
+		overflowLabels := prometheus.Labels{}
+		for _, name := range jm.series.names {
+			overflowLabels[name] = jm.overflowValue
+		}
+		// overflow series is always allowed
+		jm.series.update(overflowLabels, now, 0, updateFn)
+		cmu.updateOverflowSamples(jm.collector, jm.name)
+		return
+	}
+
+	cmu.updateDroppedSamples(jm.collector, jm.name)
+}
+
+// updateValue updates the series of the label set with given value. ts is the
+// sample timestamp taken from the payload, samples older than the current
+// sample of the series doesn't set gauge or counter value.
+func (jm *jsonMetric) updateValue(labels prometheus.Labels, v float64, ts time.Time) error {
+	if jm.metricType == CounterMetric && v < 0 {
+		return fmt.Errorf("counter cannot decrease value:%v", v)
+	}
+
+	jm.updateSeries(labels, func(s *series) {
+		switch jm.metricType {
+
+		case CounterMetric:
+			switch jm.operation {
+			case OperationSet:
+				if isOlder(ts, s.timestamp) {
+					return
+				}
+				// v is the cumulative total of the source, drop in the total
+				// means source counter was reset and v is counted since reset
+				if v >= s.total {
+					s.value += v - s.total
+				} else {
+					s.value += v
+				}
+				s.total = v
+			default:
+				s.value += v
+			}
+
+		case GaugeMetric:
+			switch jm.operation {
+			case OperationAdd:
+				s.value += v
+			default:
+				if isOlder(ts, s.timestamp) {
+					return
+				}
+				s.value = v
+			}
+
+		case HistogramMetric, SummaryMetric:
+			if s.observer == nil {
+				s.observer = jm.observerVec(s).With(s.labels)
+			}
+			s.observer.Observe(v)
+
+		case InfoMetric:
+			s.value = 1
+		}
+
+		if ts.After(s.timestamp) {
+			s.timestamp = ts
+		}
+	})
+	return nil
+}
+
+// updateState sets given state of the stateset to 1 and all the other states to 0
+func (jm *jsonMetric) updateState(labels prometheus.Labels, state string, ts time.Time) error {
+	if !slices.Contains(jm.states, state) {
+		return fmt.Errorf("unknown state:%s", state)
+	}
+
+	jm.updateSeries(labels, func(s *series) {
+		if isOlder(ts, s.timestamp) {
+			return
+		}
+		s.state = state
+		if ts.After(s.timestamp) {
+			s.timestamp = ts
+		}
+	})
+	return nil
+}
+
+// observerVec returns histogram or summary vector for the label names of the
+// series, it must be called while holding series store lock.
+func (jm *jsonMetric) observerVec(s *series) observerVec {
+	key := strings.Join(s.labelNames, ",")
+
+	vec, ok := jm.observerVecs[key]
+	if !ok {
+		switch jm.metricType {
+		case HistogramMetric:
+			vec = prometheus.NewHistogramVec(jm.histogramOpts, s.labelNames)
+		case SummaryMetric:
+			vec = prometheus.NewSummaryVec(jm.summaryOpts, s.labelNames)
+		}
+		jm.observerVecs[key] = vec
+	}
+	return vec
+}
+
+// deleteSeries releases resources of the removed series
+func (jm *jsonMetric) deleteSeries(s *series) {
+	if s.observer != nil {
+		jm.observerVec(s).Delete(s.labels)
+	}
+}
+
+// isOlder returns true if sample timestamp is set and before the last timestamp
+func isOlder(ts, last time.Time) bool {
+	return !ts.IsZero() && ts.Before(last)
+}
+
+func extractAllValues(ctx context.Context, code *jq.Code, input any) ([]any, error) {
+	var values []any
+	iter := code.RunWithContext(ctx, input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return values, nil
+		}
+		if err, ok := v.(error); ok {
+			return nil, fmt.Errorf("unable to get value err:%w", err)
 		}
+		values = append(values, v)
 	}
 }
 
-func extractFirstValue(ctx context.Context, code *gojq.Code, input any) (any, error) {
+func extractFirstValue(ctx context.Context, code *jq.Code, input any) (any, error) {
 	iter := code.RunWithContext(ctx, input)
 	v, ok := iter.Next()
 	if !ok {
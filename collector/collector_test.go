@@ -6,13 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -23,6 +27,12 @@ var (
 	hashLineReg  = regexp.MustCompile(`#.*`)
 )
 
+func TestMain(m *testing.M) {
+	// exporter metrics are updated during collection
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	os.Exit(m.Run())
+}
+
 func mustParseJson(data string) any {
 	var payload any
 	if err := json.Unmarshal([]byte(data), &payload); err != nil {
@@ -159,7 +169,7 @@ func TestJSONCollector_process(t *testing.T) {
 						{
 							Name: "value_count",
 							Path: ".values[]", Filter: `.notInData == "ACTIVE"`,
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						},
 					},
 				},
@@ -184,19 +194,19 @@ func TestJSONCollector_process(t *testing.T) {
 							Name: "value_count", Type: "counter",
 							Path: ".values[]", Filter: `.state == "ACTIVE"`,
 							Value:  ".count",
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						},
 						{ // gauge will set last values
 							Name: "value_gauge", Type: "gauge",
 							Path: ".values[]", Filter: `.state == "ACTIVE"`,
 							Value:  ".count",
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						},
 						{ // gauge with add operations will add all values
 							Name: "value_gauge_with_add", Type: "gauge",
 							Path: ".values[]", Filter: `.state == "ACTIVE"`,
 							Value: ".count", Operation: OperationAdd,
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						},
 					},
 				},
@@ -236,7 +246,7 @@ func TestJSONCollector_process(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
-			collector, err := jsonCollector(tt.args.c, reg, log)
+			collector, err := newJSONCollector(tt.args.c, reg, log, nil)
 			if err != nil {
 				t.Fatalf("JSONCollector.process() error = %v", err)
 			}
@@ -280,32 +290,32 @@ func TestJSONCollector_process_labelValues(t *testing.T) {
 					Metrics: []*Metric{
 						{
 							Name: "global_counter", Type: "gauge", Value: ".counter",
-							Labels: []Label{{"location", `"planet-"+ .location`}},
+							Labels: []Label{{Name: "location", Value: `"planet-"+ .location`}},
 						},
 						{
 							Name: "global_values", Type: "gauge", Value: ".values | length",
-							Labels: []Label{{"location", `"planet-"+ .location`}},
+							Labels: []Label{{Name: "location", Value: `"planet-"+ .location`}},
 						},
 						{
 							Name: "global_published", Type: "gauge", Value: `.published | .[0:19] +"Z"  | fromdateiso8601`,
-							Labels: []Label{{"location", `"planet-"+ .location`}},
+							Labels: []Label{{Name: "location", Value: `"planet-"+ .location`}},
 						},
 						{
 							Name: "value_active",
 							Path: ".values_text[]", Filter: `.state == "ACTIVE"`,
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						}, {
 							Name: "value_count",
 							Path: ".values_text[]", Filter: `.state == "ACTIVE"`, Value: ".count",
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						}, {
 							Name: "value_boolean",
 							Path: ".values_text[]", Filter: `.state == "ACTIVE"`, Value: ".some_boolean",
-							Labels: []Label{{"id", ".id"}},
+							Labels: []Label{{Name: "id", Value: ".id"}},
 						}, {
 							Name: "value_boolean_with_count_label",
 							Path: ".values_text[]", Filter: `.state == "ACTIVE"`, Value: ".some_boolean",
-							Labels: []Label{{"id", ".id"}, {"count", ".count"}},
+							Labels: []Label{{Name: "id", Value: ".id"}, {Name: "count", Value: ".count"}},
 						},
 					},
 				},
@@ -367,7 +377,7 @@ func TestJSONCollector_process_labelValues(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
-			collector, err := jsonCollector(tt.args.c, reg, log)
+			collector, err := newJSONCollector(tt.args.c, reg, log, nil)
 			if err != nil {
 				t.Fatalf("JSONCollector.process() error = %v", err)
 			}
@@ -575,3 +585,1357 @@ func TestJSONCollector_process_multiplePayload(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONCollector_process_histogram(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "latency_seconds", Type: HistogramMetric,
+				Path: ".values[]", Value: ".latency",
+				Buckets: []float64{0.1, 1},
+				Labels:  []Label{{Name: "id", Value: ".id"}},
+			},
+			{
+				Name: "size_bytes", Type: HistogramMetric,
+				Path: ".values[]", Value: ".size",
+				ExponentialBuckets: &ExponentialBuckets{Start: 10, Factor: 10, Count: 2},
+			},
+		},
+	}
+	input := mustParseJson(`
+	{
+		"values": [
+			{"id": "id-A","latency": 0.05,"size": 5},
+			{"id": "id-A","latency": 0.5,"size": 50},
+			{"id": "id-B","latency": 5,"size": 500}
+		]
+	}`)
+
+	expected := `test_latency_seconds_bucket{id="id-A",le="0.1"} 1
+test_latency_seconds_bucket{id="id-A",le="1"} 2
+test_latency_seconds_bucket{id="id-A",le="+Inf"} 2
+test_latency_seconds_sum{id="id-A"} 0.55
+test_latency_seconds_count{id="id-A"} 2
+test_latency_seconds_bucket{id="id-B",le="0.1"} 0
+test_latency_seconds_bucket{id="id-B",le="1"} 0
+test_latency_seconds_bucket{id="id-B",le="+Inf"} 1
+test_latency_seconds_sum{id="id-B"} 5
+test_latency_seconds_count{id="id-B"} 1
+test_size_bytes_bucket{le="10"} 1
+test_size_bytes_bucket{le="100"} 2
+test_size_bytes_bucket{le="+Inf"} 3
+test_size_bytes_sum 555
+test_size_bytes_count 3`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_summary(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "latency_seconds", Type: SummaryMetric,
+				Path: ".values[]", Value: ".latency",
+				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01},
+				MaxAge:     time.Hour,
+				Labels:     []Label{{Name: "id", Value: ".id"}},
+			},
+		},
+	}
+	input := mustParseJson(`
+	{
+		"values": [
+			{"id": "id-A","latency": 1},
+			{"id": "id-A","latency": 2},
+			{"id": "id-A","latency": 3},
+			{"id": "id-B","latency": "5"}
+		]
+	}`)
+
+	expected := `test_latency_seconds{id="id-A",quantile="0.5"} 2
+test_latency_seconds{id="id-A",quantile="0.9"} 3
+test_latency_seconds_sum{id="id-A"} 6
+test_latency_seconds_count{id="id-A"} 3
+test_latency_seconds{id="id-B",quantile="0.5"} 5
+test_latency_seconds{id="id-B",quantile="0.9"} 5
+test_latency_seconds_sum{id="id-B"} 5
+test_latency_seconds_count{id="id-B"} 1`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_nativeHistogram(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "latency_seconds", Type: HistogramMetric,
+				Path: ".values[]", Value: ".latency",
+				NativeHistogramBucketFactor:  1.1,
+				NativeHistogramZeroThreshold: 0.001,
+			},
+			{
+				Name: "latency_classic_seconds", Type: HistogramMetric,
+				Path: ".values[]", Value: ".latency",
+				Buckets:                     []float64{1},
+				NativeHistogramBucketFactor: 1.1,
+			},
+		},
+	}
+	input := mustParseJson(`{"values": [{"latency": 0},{"latency": 0.5},{"latency": 2}]}`)
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+	if len(gathering) != 2 {
+		t.Fatalf("JSONCollector.process() got %d metric families want 2", len(gathering))
+	}
+
+	tests := []struct {
+		name           string
+		classicBuckets int
+	}{
+		{"test_latency_classic_seconds", 1},
+		{"test_latency_seconds", 0},
+	}
+	for i, tt := range tests {
+		mf := gathering[i]
+		if mf.GetName() != tt.name {
+			t.Fatalf("unexpected metric family got %s want %s", mf.GetName(), tt.name)
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 3 {
+			t.Errorf("%s sample count got %d want 3", tt.name, h.GetSampleCount())
+		}
+		if h.GetZeroCount() != 1 {
+			t.Errorf("%s zero count got %d want 1", tt.name, h.GetZeroCount())
+		}
+		if len(h.GetPositiveSpan()) == 0 {
+			t.Errorf("%s native histogram has no positive spans", tt.name)
+		}
+		if len(h.GetBucket()) != tt.classicBuckets {
+			t.Errorf("%s classic buckets got %d want %d", tt.name, len(h.GetBucket()), tt.classicBuckets)
+		}
+	}
+}
+
+func TestJSONCollector_process_infoStateSet(t *testing.T) {
+	log := slog.Default()
+
+	type args struct {
+		c     *Collector
+		input any
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+		want     bool
+	}{
+		{
+			name: "info",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "build_info", Type: InfoMetric, Path: ".apps[]",
+						Labels: []Label{{Name: "app", Value: ".name"}, {Name: "version", Value: ".version"}},
+					}},
+				},
+				mustParseJson(`{"apps": [{"name": "a","version": "1.0"},{"name": "b","version": "2.1"}]}`),
+			},
+			expected: `test_build_info{app="a",version="1.0"} 1
+test_build_info{app="b",version="2.1"} 1`,
+			want: true,
+		},
+		{
+			name: "stateset",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "outcome", Type: StateSetMetric, Path: ".events[]", Value: ".outcome",
+						States: []string{"SUCCESS", "FAILURE", "SKIPPED"},
+						Labels: []Label{{Name: "app", Value: ".app"}},
+					}},
+				},
+				mustParseJson(`
+				{
+					"events": [
+						{"app": "a","outcome": "FAILURE"},
+						{"app": "b","outcome": "SKIPPED"},
+						{"app": "a","outcome": "SUCCESS"}
+					]
+				}`),
+			},
+			expected: `test_outcome{app="a",outcome="FAILURE"} 0
+test_outcome{app="a",outcome="SKIPPED"} 0
+test_outcome{app="a",outcome="SUCCESS"} 1
+test_outcome{app="b",outcome="FAILURE"} 0
+test_outcome{app="b",outcome="SKIPPED"} 1
+test_outcome{app="b",outcome="SUCCESS"} 0`,
+			want: true,
+		},
+		{
+			name: "stateset-unknown-state",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "outcome", Type: StateSetMetric, Path: ".events[]", Value: ".outcome",
+						States: []string{"SUCCESS", "FAILURE"},
+					}},
+				},
+				mustParseJson(`{"events": [{"outcome": "UNKNOWN"}]}`),
+			},
+			expected: ``,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			collector, err := newJSONCollector(tt.args.c, reg, log, nil)
+			if err != nil {
+				t.Fatalf("JSONCollector.process() error = %v", err)
+			}
+
+			if got := collector.process(context.Background(), tt.args.input); got != tt.want {
+				t.Errorf("JSONCollector.process() = %v, want %v", got, tt.want)
+			}
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.process() error = %v", err)
+			}
+
+			if diff := cmp.Diff(metricsToText(gathering, true), tt.expected); diff != "" {
+				t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_process_stateSet(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "states",
+		Namespace: "test",
+		Metrics: []*Metric{{
+			Name: "event_state", Type: StateSetMetric, Path: ".[]", Value: ".state", Timestamp: ".epoch",
+			States: []string{"ACTIVE", "INACTIVE"},
+			Labels: []Label{{Name: "app", Value: ".app"}},
+		}},
+	}
+	// sample without timestamp doesn't reset the timestamp of the series
+	input := mustParseJson(`
+	[
+		{"app": "a", "state": "ACTIVE", "epoch": 1702980000},
+		{"app": "a", "state": "INACTIVE"},
+		{"app": "a", "state": "UNKNOWN", "epoch": 1702980137}
+	]`)
+
+	expected := `test_event_state{app="a",event_state="ACTIVE"} 0 1702980000000
+test_event_state{app="a",event_state="INACTIVE"} 1 1702980000000`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, false)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := testutil.ToFloat64(cm.collectionErrors.WithLabelValues("states", "event_state", errClassValue)); got != 1 {
+		t.Errorf("collection_errors_total class:%s = %v, want %v", errClassValue, got, 1)
+	}
+}
+
+func TestJSONCollector_expireSeries(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		TTL:       time.Hour,
+		Metrics: []*Metric{
+			{
+				Name: "value_count", Path: ".values[]", Value: ".count",
+				TTL:    time.Minute,
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+			{
+				Name: "value_state", Type: StateSetMetric, Path: ".values[]", Value: ".state",
+				States: []string{"ACTIVE", "INACTIVE"},
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+			{
+				Name: "value_info", Type: InfoMetric, Path: ".values[]",
+				TTL:    3 * time.Hour,
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+		},
+	}
+	input := mustParseJson(`
+	{
+		"values": [
+			{"id": "id-A","count": 2,"state": "ACTIVE"},
+			{"id": "id-B","count": 5,"state": "INACTIVE"}
+		]
+	}`)
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	if collector.sweepInterval != 30*time.Second {
+		t.Errorf("newJSONCollector() sweepInterval = %v, want %v", collector.sweepInterval, 30*time.Second)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		want     int
+		expected string
+	}{
+		{
+			"nothing-expired",
+			time.Now(),
+			0,
+			`test_value_count{id="id-A"} 2
+test_value_count{id="id-B"} 5
+test_value_info{id="id-A"} 1
+test_value_info{id="id-B"} 1
+test_value_state{id="id-A",value_state="ACTIVE"} 1
+test_value_state{id="id-A",value_state="INACTIVE"} 0
+test_value_state{id="id-B",value_state="ACTIVE"} 0
+test_value_state{id="id-B",value_state="INACTIVE"} 1`,
+		},
+		{
+			"metric-ttl-expired",
+			time.Now().Add(2 * time.Minute),
+			2,
+			`test_value_info{id="id-A"} 1
+test_value_info{id="id-B"} 1
+test_value_state{id="id-A",value_state="ACTIVE"} 1
+test_value_state{id="id-A",value_state="INACTIVE"} 0
+test_value_state{id="id-B",value_state="ACTIVE"} 0
+test_value_state{id="id-B",value_state="INACTIVE"} 1`,
+		},
+		{
+			"collector-ttl-expired",
+			time.Now().Add(2 * time.Hour),
+			2,
+			`test_value_info{id="id-A"} 1
+test_value_info{id="id-B"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collector.expireSeries(tt.now); got != tt.want {
+				t.Errorf("JSONCollector.expireSeries() = %v, want %v", got, tt.want)
+			}
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.expireSeries() error = %v", err)
+			}
+
+			if diff := cmp.Diff(metricsToText(gathering, true), tt.expected); diff != "" {
+				t.Errorf("JSONCollector.expireSeries() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_process_maxSeries(t *testing.T) {
+	log := slog.Default()
+
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "limits",
+		Namespace: "test",
+		MaxSeries: 2,
+		Metrics: []*Metric{
+			{
+				Name: "dropped_count", Path: ".values[]", Value: ".count",
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+			{
+				Name: "folded_count", Path: ".values[]", Value: ".count",
+				Overflow: OverflowFold,
+				Labels:   []Label{{Name: "id", Value: ".id"}, {Name: "state", Value: ".state"}},
+			},
+			{
+				Name: "folded_state", Type: StateSetMetric, Path: ".values[]", Value: ".state",
+				States:    []string{"ACTIVE", "INACTIVE"},
+				MaxSeries: 1, Overflow: OverflowFold, OverflowValue: "other",
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+		},
+	}
+	input := mustParseJson(`
+	{
+		"values": [
+			{"id": "id-A","count": 1,"state": "ACTIVE"},
+			{"id": "id-B","count": 2,"state": "INACTIVE"},
+			{"id": "id-C","count": 3,"state": "ACTIVE"},
+			{"id": "id-A","count": 4,"state": "ACTIVE"},
+			{"id": "id-D","count": 5,"state": "INACTIVE"}
+		]
+	}`)
+
+	expected := `test_dropped_count{id="id-A"} 5
+test_dropped_count{id="id-B"} 2
+test_folded_count{id="__other__",state="__other__"} 8
+test_folded_count{id="id-A",state="ACTIVE"} 5
+test_folded_count{id="id-B",state="INACTIVE"} 2
+test_folded_state{folded_state="ACTIVE",id="id-A"} 1
+test_folded_state{folded_state="ACTIVE",id="other"} 0
+test_folded_state{folded_state="INACTIVE",id="id-A"} 0
+test_folded_state{folded_state="INACTIVE",id="other"} 1`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := testutil.ToFloat64(cm.droppedSamples.WithLabelValues("limits", "dropped_count")); got != 2 {
+		t.Errorf("dropped samples = %v, want %v", got, 2)
+	}
+	if got := testutil.ToFloat64(cm.overflowSamples.WithLabelValues("limits", "folded_count")); got != 2 {
+		t.Errorf("overflow samples = %v, want %v", got, 2)
+	}
+	if got := testutil.ToFloat64(cm.overflowSamples.WithLabelValues("limits", "folded_state")); got != 3 {
+		t.Errorf("overflow samples = %v, want %v", got, 3)
+	}
+}
+
+func TestJSONCollector_process_expandLabels(t *testing.T) {
+	log := slog.Default()
+
+	type args struct {
+		c     *Collector
+		input any
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+		want     bool
+	}{
+		{
+			name: "single-expand-label",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "events_total", Path: ".[]",
+						Labels: []Label{
+							{Name: "event", Value: ".eventType"},
+							{Name: "application", Value: `.target[] | select(.type == "AppInstance") | .alternateId`, Expand: true},
+						},
+					}},
+				},
+				mustParseJson(`
+				[
+					{"eventType": "import","target": [
+						{"type": "AppInstance","alternateId": "app-a"},
+						{"type": "User","alternateId": "user"},
+						{"type": "AppInstance","alternateId": "app-b"}
+					]},
+					{"eventType": "import","target": [{"type": "AppInstance","alternateId": "app-a"}]},
+					{"eventType": "import","target": []}
+				]`),
+			},
+			expected: `test_events_total{application="app-a",event="import"} 2
+test_events_total{application="app-b",event="import"} 1`,
+			want: true,
+		},
+		{
+			name: "cartesian-product",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "value", Type: GaugeMetric, Value: ".value",
+						Labels: []Label{
+							{Name: "app", Value: ".apps[]", Expand: true},
+							{Name: "env", Value: ".envs[]", Expand: true},
+						},
+					}},
+				},
+				mustParseJson(`{"value": 5, "apps": ["a","b"], "envs": ["dev","prod"]}`),
+			},
+			expected: `test_value{app="a",env="dev"} 5
+test_value{app="a",env="prod"} 5
+test_value{app="b",env="dev"} 5
+test_value{app="b",env="prod"} 5`,
+			want: true,
+		},
+		{
+			name: "too-many-combinations",
+			args: args{
+				&Collector{
+					Namespace: "test",
+					Metrics: []*Metric{{
+						Name: "value", Type: GaugeMetric, Value: ".value",
+						MaxLabelCombinations: 3,
+						Labels: []Label{
+							{Name: "app", Value: ".apps[]", Expand: true},
+							{Name: "env", Value: ".envs[]", Expand: true},
+						},
+					}},
+				},
+				mustParseJson(`{"value": 5, "apps": ["a","b"], "envs": ["dev","prod"]}`),
+			},
+			expected: ``,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			collector, err := newJSONCollector(tt.args.c, reg, log, nil)
+			if err != nil {
+				t.Fatalf("JSONCollector.process() error = %v", err)
+			}
+
+			if got := collector.process(context.Background(), tt.args.input); got != tt.want {
+				t.Errorf("JSONCollector.process() = %v, want %v", got, tt.want)
+			}
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.process() error = %v", err)
+			}
+
+			if diff := cmp.Diff(metricsToText(gathering, true), tt.expected); diff != "" {
+				t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_process_aggregate(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{Name: "first", Type: GaugeMetric, Value: ".values[].count"},
+			{Name: "last", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateLast},
+			{Name: "sum", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateSum},
+			{Name: "count", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateCount},
+			{Name: "min", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateMin},
+			{Name: "max", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateMax},
+			{Name: "avg", Type: GaugeMetric, Value: ".values[].count", Aggregate: AggregateAvg},
+			{Name: "sum_total", Value: ".values[].count", Aggregate: AggregateSum},
+			{Name: "avg_none", Type: GaugeMetric, Value: ".values[].missing", Aggregate: AggregateAvg},
+		},
+	}
+	input := mustParseJson(`
+	{
+		"values": [
+			{"id": "id-A","count": 2},
+			{"id": "id-B"},
+			{"id": "id-C","count": 6},
+			{"id": "id-D","count": 1}
+		]
+	}`)
+
+	expected := `test_avg 3
+test_count 3
+test_first 2
+test_last 1
+test_max 6
+test_min 1
+test_sum 9
+test_sum_total 9`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_relabel(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace:     "test",
+		DefaultLabels: []Label{{Name: "env", Value: ".env"}},
+		RelabelConfigs: []RelabelConfig{
+			{SourceLabels: []string{"env"}, Regex: "dev", Action: RelabelDrop},
+		},
+		Metrics: []*Metric{
+			{
+				Name:   "events_total",
+				Path:   ".events[]",
+				Labels: []Label{{Name: "app", Value: ".app"}, {Name: "user", Value: ".user"}},
+				RelabelConfigs: []RelabelConfig{
+					{SourceLabels: []string{"app"}, TargetLabel: "app", Action: RelabelLowercase},
+					{SourceLabels: []string{"user"}, Regex: "(.*)@.*", TargetLabel: "domain", Replacement: "external"},
+					{Regex: "user", Action: RelabelLabelDrop},
+				},
+			},
+			{
+				Name:   "duration_seconds",
+				Path:   ".events[]",
+				Type:   HistogramMetric,
+				Labels: []Label{{Name: "bucket", Value: ".app"}},
+				RelabelConfigs: []RelabelConfig{
+					{SourceLabels: []string{"bucket"}, TargetLabel: "le"},
+				},
+			},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	inputs := []struct {
+		payload string
+		want    bool
+	}{
+		// histogram is not updated as relabeling sets reserved le label
+		{`{"events": [{"env": "prod", "app": "HR", "user": "a"}, {"env": "prod", "app": "hr", "user": "b@example.com"}, {"env": "prod", "app": "Ops", "user": "c"}]}`, false},
+		// label sets of both the metrics are dropped by collector's relabel config
+		{`{"events": [{"env": "dev", "app": "HR", "user": "a"}]}`, true},
+	}
+	for _, input := range inputs {
+		if got := collector.process(context.Background(), mustParseJson(input.payload)); got != input.want {
+			t.Errorf("JSONCollector.process() = %v, want %v", got, input.want)
+		}
+	}
+
+	expected := `test_events_total{app="hr",env="prod"} 1
+test_events_total{app="ops",env="prod"} 1
+test_events_total{app="hr",domain="external",env="prod"} 1`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_timestamp(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "events_total", Path: ".[]", Timestamp: ".published",
+				Labels: []Label{{Name: "app", Value: ".app"}},
+			},
+			{
+				Name: "event_count", Type: GaugeMetric, Path: ".[]", Value: ".count", Timestamp: ".published",
+				Labels: []Label{{Name: "app", Value: ".app"}},
+			},
+			{
+				Name: "event_state", Type: StateSetMetric, Path: ".[]", Value: ".state", Timestamp: ".epoch",
+				States: []string{"ACTIVE", "INACTIVE"},
+				Labels: []Label{{Name: "app", Value: ".app"}},
+			},
+			{
+				Name: "events_no_timestamp_total", Path: ".[]",
+				Labels: []Label{{Name: "app", Value: ".app"}},
+			},
+		},
+	}
+	// 2nd event of app 'a' is older then 1st one
+	input := mustParseJson(`
+	[
+		{"app": "a","count": 1,"state": "ACTIVE","published": "2023-12-19T10:02:17.972Z","epoch": 1702980137.972},
+		{"app": "a","count": 2,"state": "INACTIVE","published": "2023-12-19T10:00:00Z","epoch": 1702980000},
+		{"app": "b","count": 3,"state": "INACTIVE","published": "2023-12-19T11:00:00+01:00","epoch": 1702980000}
+	]`)
+
+	expected := `test_event_count{app="a"} 1 1702980137972
+test_event_count{app="b"} 3 1702980000000
+test_event_state{app="a",event_state="ACTIVE"} 1 1702980137972
+test_event_state{app="a",event_state="INACTIVE"} 0 1702980137972
+test_event_state{app="b",event_state="ACTIVE"} 0 1702980000000
+test_event_state{app="b",event_state="INACTIVE"} 1 1702980000000
+test_events_no_timestamp_total{app="a"} 2
+test_events_no_timestamp_total{app="b"} 1
+test_events_total{app="a"} 2 1702980137972
+test_events_total{app="b"} 1 1702980000000`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_functions(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "memory_bytes", Type: GaugeMetric, Path: ".[]", Value: ".memory | parse_bytes",
+				Timestamp: ".published | parse_rfc3339",
+				Labels:    []Label{{Name: "app", Value: `.image | regex_extract("/([^/:]+):")`}},
+			},
+			{
+				Name: "uptime_seconds", Type: GaugeMetric, Path: ".[]", Value: ".uptime | parse_duration",
+				Labels: []Label{{Name: "app", Value: `.image | regex_extract("/([^/:]+):")`}},
+			},
+		},
+	}
+	input := mustParseJson(`
+	[
+		{"image": "registry/app-a:v1", "memory": "512MiB", "uptime": "1h5m", "published": "2023-12-19T10:02:17.972+01:00"},
+		{"image": "registry/app-b:v2", "memory": "1.5 GB", "uptime": "90s", "published": "2023-12-19T09:00:00Z"}
+	]`)
+
+	expected := `test_memory_bytes{app="app-a"} 5.36870912e+08 1702976537972
+test_memory_bytes{app="app-b"} 1.5e+09 1702976400000
+test_uptime_seconds{app="app-a"} 3900
+test_uptime_seconds{app="app-b"} 90`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_process_counterSet(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "requests_total", Operation: OperationSet,
+				Path: ".[]", Value: ".requests_total",
+				Labels: []Label{{Name: "app", Value: ".app"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		input    any
+		expected string
+	}{
+		{
+			"initial-totals",
+			mustParseJson(`[{"app": "a","requests_total": 100},{"app": "b","requests_total": 5}]`),
+			`test_requests_total{app="a"} 100
+test_requests_total{app="b"} 5`,
+		},
+		{
+			"same-totals-sent-again",
+			mustParseJson(`[{"app": "a","requests_total": 100},{"app": "b","requests_total": 5}]`),
+			`test_requests_total{app="a"} 100
+test_requests_total{app="b"} 5`,
+		},
+		{
+			"increase",
+			mustParseJson(`[{"app": "a","requests_total": 150}]`),
+			`test_requests_total{app="a"} 150
+test_requests_total{app="b"} 5`,
+		},
+		{
+			"reset",
+			mustParseJson(`[{"app": "a","requests_total": 20},{"app": "a","requests_total": 30}]`),
+			`test_requests_total{app="a"} 180
+test_requests_total{app="b"} 5`,
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collector.process(context.Background(), tt.input); !got {
+				t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+			}
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.process() error = %v", err)
+			}
+
+			if diff := cmp.Diff(metricsToText(gathering, true), tt.expected); diff != "" {
+				t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_process_onError(t *testing.T) {
+	log := slog.Default()
+
+	metrics := func() []*Metric {
+		return []*Metric{
+			{
+				Name: "value_count", Path: ".values[]", Value: ".count",
+				Labels: []Label{{Name: "id", Value: ".id"}},
+			},
+			{
+				Name: "nested_count", Path: ".nested[]", Value: ".count",
+			},
+			{
+				Name: "total", Value: ".total",
+			},
+		}
+	}
+	// 2nd object has invalid value and 'nested' is null
+	input := mustParseJson(`{
+		"values": [{"id": "a", "count": 1}, {"id": "b", "count": "blah"}, {"id": "c", "count": 3}],
+		"total": 4
+	}`)
+
+	tests := []struct {
+		name            string
+		onError         ErrorPolicy
+		onNullIteration NullIterationPolicy
+		expected        string
+		wantErrors      map[string]float64
+	}{
+		{
+			"skip-object",
+			OnErrorSkipObject, NullIterationIgnore,
+			`test_total 4
+test_value_count{id="a"} 1
+test_value_count{id="c"} 3`,
+			map[string]float64{"value_count/value": 1},
+		},
+		{
+			"skip-metric",
+			OnErrorSkipMetric, NullIterationIgnore,
+			`test_total 4
+test_value_count{id="a"} 1`,
+			map[string]float64{"value_count/value": 1},
+		},
+		{
+			"abort",
+			OnErrorAbort, NullIterationIgnore,
+			`test_value_count{id="a"} 1`,
+			map[string]float64{"value_count/value": 1},
+		},
+		{
+			"null-iteration-error",
+			OnErrorSkipObject, NullIterationError,
+			`test_total 4
+test_value_count{id="a"} 1
+test_value_count{id="c"} 3`,
+			map[string]float64{"value_count/value": 1, "nested_count/null_iteration": 1},
+		},
+		{
+			"null-iteration-error-abort",
+			OnErrorAbort, NullIterationError,
+			`test_value_count{id="a"} 1`,
+			map[string]float64{"value_count/value": 1, "nested_count/null_iteration": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitMetrics(prometheus.NewRegistry(), "test_exporter")
+			cm := cmu.(*collectorMetrics)
+
+			c := &Collector{
+				id:              "errors",
+				Namespace:       "test",
+				OnError:         tt.onError,
+				OnNullIteration: tt.onNullIteration,
+				Metrics:         metrics(),
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			collector, err := newJSONCollector(c, reg, log, nil)
+			if err != nil {
+				t.Fatalf("JSONCollector.process() error = %v", err)
+			}
+
+			if got := collector.process(context.Background(), input); got {
+				t.Errorf("JSONCollector.process() = %v, want %v", got, false)
+			}
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.process() error = %v", err)
+			}
+
+			if diff := cmp.Diff(metricsToText(gathering, true), tt.expected); diff != "" {
+				t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+			}
+
+			for key, want := range tt.wantErrors {
+				metric, class, _ := strings.Cut(key, "/")
+				got := testutil.ToFloat64(cm.collectionErrors.WithLabelValues("errors", metric, class))
+				if got != want {
+					t.Errorf("collection_errors_total metric:%s class:%s = %v, want %v", metric, class, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONCollector_process_timeout(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "timeout",
+		Namespace: "test",
+		OnError:   OnErrorSkipObject,
+		Metrics: []*Metric{
+			{Name: "slow", Path: ".[]", Value: "last(range(1e9))"},
+			{Name: "fast", Value: "1"},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if got := collector.process(ctx, mustParseJson(`[1, 2]`)); got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, false)
+	}
+
+	// timeout aborts the rest of the payload
+	if got := testutil.ToFloat64(cm.collectionErrors.WithLabelValues("timeout", "slow", errClassTimeout)); got != 1 {
+		t.Errorf("collection_errors_total class:timeout = %v, want %v", got, 1)
+	}
+	if got := testutil.CollectAndCount(reg); got != 0 {
+		t.Errorf("JSONCollector.process() collected %v metrics, want %v", got, 0)
+	}
+}
+
+func TestLoad_reuse(t *testing.T) {
+	log := slog.Default()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unable to write config err:%v", err)
+		}
+	}
+
+	writeConfig(`
+collectors:
+  reload:
+    namespace: test
+    metrics:
+      - name: unchanged_total
+        path: .[]
+        labels:
+          - name: app
+            value: .app
+      - name: changed_total
+        path: .[]
+        labels:
+          - name: app
+            value: .app
+      - name: removed_total
+        path: .[]
+`)
+
+	reg := prometheus.NewPedanticRegistry()
+	previous, err := Load(path, reg, log, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	previous["reload"].process(context.Background(), mustParseJson(`[{"app": "a"}, {"app": "b"}]`))
+
+	writeConfig(`
+collectors:
+  reload:
+    namespace: test
+    metrics:
+      - name: unchanged_total
+        path: .[]
+        labels:
+          - name: app
+            value: .app
+      - name: changed_total
+        path: .[]
+        labels:
+          - name: name
+            value: .app
+      - name: added_total
+        path: .[]
+`)
+
+	// a new registry is used on reload
+	newReg := prometheus.NewPedanticRegistry()
+	collectors, err := Load(path, newReg, log, previous)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	collectors["reload"].process(context.Background(), mustParseJson(`[{"app": "a"}]`))
+
+	expected := `test_added_total 1
+test_changed_total{name="a"} 1
+test_unchanged_total{app="a"} 2
+test_unchanged_total{app="b"} 1`
+
+	gathering, err := newReg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoad_jq(t *testing.T) {
+	dir := t.TempDir()
+	module := `def app_id: .target[] | select(.type == "AppInstance") | .alternateId;`
+	if err := os.WriteFile(filepath.Join(dir, "okta.jq"), []byte(module), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+jq:
+  definitions: |
+    def outcome: .outcome.result | ascii_downcase;
+  libraryPaths:
+    - .
+collectors:
+  okta:
+    namespace: test
+    defaultLabels:
+      - name: outcome
+        value: outcome
+    metrics:
+      - name: import_events_total
+        path: .[]
+        labels:
+          - name: application
+            value: 'import "okta" as okta; okta::app_id'
+`
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collectors, err := Load(path, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	collectors["okta"].process(context.Background(), mustParseJson(`[
+		{"outcome": {"result": "SUCCESS"}, "target": [{"type": "User"}, {"type": "AppInstance", "alternateId": "hr"}]}
+	]`))
+
+	expected := `test_import_events_total{application="hr",outcome="success"} 1`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoad_variables(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "region"), []byte("eu-west-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_CLUSTER", "prod-1")
+	t.Setenv("TEST_TEAM", "infra")
+
+	config := `
+variables:
+  - name: cluster
+    valueFromEnv: TEST_CLUSTER
+  - name: region
+    valueFromFile: region
+  - name: env
+    value: prod
+collectors:
+  okta:
+    namespace: test
+    defaultLabels:
+      - name: cluster
+        value: $cluster
+      - name: region
+        value: $region
+    metrics:
+      - name: import_events_total
+        path: .[]
+        filter: .env == $env
+        labels:
+          - name: team
+            value: $ENV.TEST_TEAM
+`
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collectors, err := Load(path, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	collectors["okta"].process(context.Background(), mustParseJson(`[
+		{"env": "prod"}, {"env": "dev"}, {"env": "prod"}
+	]`))
+
+	expected := `test_import_events_total{cluster="prod-1",region="eu-west-1",team="infra"} 2`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_Stop(t *testing.T) {
+	tests := []struct {
+		name        string
+		ordering    Ordering
+		orderingKey string
+	}{
+		{"none", OrderingNone, ""},
+		// inputs in the queues of the workers are also processed
+		{"per-key", OrderingPerKey, ".[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Collector{
+				id:          "stop",
+				Namespace:   "test",
+				Ordering:    tt.ordering,
+				OrderingKey: tt.orderingKey,
+				Metrics:     []*Metric{{Name: "events_total", Path: ".[]"}},
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			jc, err := newJSONCollector(c, reg, slog.Default(), nil)
+			if err != nil {
+				t.Fatalf("newJSONCollector() error = %v", err)
+			}
+
+			// queued payloads are processed before collector is stopped
+			for range 3 {
+				if err := jc.Send(context.Background(), mustParseJson(`[1, 2]`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			go jc.Start(context.Background())
+			jc.Stop()
+
+			expected := `test_events_total 6`
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("Gather() error = %v", err)
+			}
+			if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+				t.Errorf("JSONCollector.Stop() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoad_reuseDedup(t *testing.T) {
+	log := slog.Default()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig := func(ttl string) {
+		config := `
+collectors:
+  unchanged:
+    namespace: test
+    dedup:
+      key: .id
+    metrics:
+      - name: unchanged_total
+        path: .
+  changed:
+    namespace: test
+    dedup:
+      key: .id
+      ttl: ` + ttl + `
+    metrics:
+      - name: changed_total
+        path: .
+`
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unable to write config err:%v", err)
+		}
+	}
+
+	writeConfig("1h")
+	previous, err := Load(path, prometheus.NewPedanticRegistry(), log, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	ctx := context.Background()
+	for id, c := range previous {
+		if _, dup := c.isDuplicate(ctx, mustParseJson(`{"id": "1"}`)); dup {
+			t.Fatalf("JSONCollector.isDuplicate() collector:%s = true, want false", id)
+		}
+	}
+
+	writeConfig("2h")
+	collectors, err := Load(path, prometheus.NewPedanticRegistry(), log, previous)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// seen keys are only kept by the collector with unchanged dedup config
+	want := map[string]bool{"unchanged": true, "changed": false}
+	got := make(map[string]bool)
+	for id, c := range collectors {
+		_, got[id] = c.isDuplicate(ctx, mustParseJson(`{"id": "1"}`))
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("JSONCollector.isDuplicate() mismatch (-want +got):\n%s", diff)
+	}
+}
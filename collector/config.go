@@ -1,17 +1,114 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/dedup"
+	"github.com/utilitywarehouse/json_exporter/jq"
 	"gopkg.in/yaml.v2"
 )
 
 type MetricType string
 
 const (
-	CounterMetric MetricType = "counter"
-	GaugeMetric   MetricType = "gauge"
+	CounterMetric   MetricType = "counter"
+	GaugeMetric     MetricType = "gauge"
+	HistogramMetric MetricType = "histogram"
+	SummaryMetric   MetricType = "summary"
+	InfoMetric      MetricType = "info"
+	StateSetMetric  MetricType = "stateset"
+)
+
+type OverflowAction string
+
+const (
+	// OverflowDrop drops samples of new series once series limit is reached
+	OverflowDrop OverflowAction = "drop"
+	// OverflowFold folds samples of new series into an overflow series once
+	// series limit is reached
+	OverflowFold OverflowAction = "fold"
+)
+
+// Ordering defines in which order inputs of the collector are processed
+type Ordering string
+
+const (
+	// OrderingNone processes inputs concurrently by all the workers
+	OrderingNone Ordering = "none"
+	// OrderingStrict processes inputs one at a time in the order they are received
+	OrderingStrict Ordering = "strict"
+	// OrderingPerKey processes inputs with the same key one at a time in the
+	// order they are received, inputs with different keys are processed concurrently
+	OrderingPerKey Ordering = "perKey"
+)
+
+// QueuePolicy defines how inputs are handled once collector's queue is full
+type QueuePolicy string
+
+const (
+	// QueueBlock blocks the sender until there is space in the queue
+	QueueBlock QueuePolicy = "block"
+	// QueueDropNewest drops the input being sent
+	QueueDropNewest QueuePolicy = "drop-newest"
+	// QueueDropOldest drops the oldest input of the queue to make space for the new input
+	QueueDropOldest QueuePolicy = "drop-oldest"
+	// QueueReject rejects the input and webhook request is responded with RejectStatusCode
+	QueueReject QueuePolicy = "reject"
+)
+
+// ErrorPolicy defines how collection errors are handled
+type ErrorPolicy string
+
+const (
+	// OnErrorSkipObject skips the json object and continues with the next object of the metric
+	OnErrorSkipObject ErrorPolicy = "skipObject"
+	// OnErrorSkipMetric skips rest of the json objects of the metric
+	OnErrorSkipMetric ErrorPolicy = "skipMetric"
+	// OnErrorAbort skips rest of the payload including all the remaining metrics
+	OnErrorAbort ErrorPolicy = "abort"
+)
+
+// NullIterationPolicy defines how errors of iterating over null by path
+// expression are handled
+type NullIterationPolicy string
+
+const (
+	// NullIterationIgnore handles null as if there are no json objects
+	NullIterationIgnore NullIterationPolicy = "ignore"
+	// NullIterationError handles null iteration as per ErrorPolicy
+	NullIterationError NullIterationPolicy = "error"
+)
+
+const (
+	defaultWorkers = 10
+	defaultTimeout = time.Minute
+
+	defaultQueueSize             = 100
+	defaultQueueRejectStatusCode = 429
+
+	defaultOverflowValue = "__other__"
+
+	defaultMaxLabelCombinations = 100
+)
+
+// Aggregation reduces all the outputs of the value expression to a single value
+type Aggregation string
+
+const (
+	AggregateFirst Aggregation = "first"
+	AggregateLast  Aggregation = "last"
+	AggregateSum   Aggregation = "sum"
+	AggregateCount Aggregation = "count"
+	AggregateMin   Aggregation = "min"
+	AggregateMax   Aggregation = "max"
+	AggregateAvg   Aggregation = "avg"
 )
 
 type MetricOperation string
@@ -22,14 +119,49 @@ const (
 )
 
 type Config struct {
+	JQ jq.Config `yaml:"jq"`
+	// Variables are exposed as $name to all the jq expressions
+	Variables  []jq.Variable         `yaml:"variables"`
 	Collectors map[string]*Collector `yaml:"collectors"`
 }
 
 type Collector struct {
-	id            string
+	id string
+	// jq compiles the expressions with the definitions and modules of the config
+	jq            *jq.Compiler
 	Namespace     string    `yaml:"namespace"`
 	DefaultLabels []Label   `yaml:"defaultLabels"`
 	Metrics       []*Metric `yaml:"metrics"`
+	// RelabelConfigs are applied to the label sets of all the metrics of the
+	// collector before the metric's own relabel configs
+	RelabelConfigs []RelabelConfig `yaml:"relabelConfigs"`
+	// TTL, MaxSeries, Overflow and OverflowValue are the defaults of all the
+	// metrics of the collector
+	TTL           time.Duration  `yaml:"ttl"`
+	MaxSeries     int            `yaml:"maxSeries"`
+	Overflow      OverflowAction `yaml:"overflow"`
+	OverflowValue string         `yaml:"overflowValue"`
+	// Workers is the max number of inputs processed concurrently
+	Workers  int      `yaml:"workers"`
+	Ordering Ordering `yaml:"ordering"`
+	// OrderingKey is the jq expression of the input key used with perKey ordering
+	OrderingKey string `yaml:"orderingKey"`
+	Queue       Queue  `yaml:"queue"`
+	// Timeout is the max duration of processing a single payload
+	Timeout         time.Duration       `yaml:"timeout"`
+	OnError         ErrorPolicy         `yaml:"onError"`
+	OnNullIteration NullIterationPolicy `yaml:"onNullIteration"`
+	// Dedup skips the inputs already seen by the collector
+	Dedup *dedup.Config `yaml:"dedup"`
+}
+
+// Queue is the config of the input queue of the collector
+type Queue struct {
+	Size   int         `yaml:"size"`
+	Policy QueuePolicy `yaml:"policy"`
+	// RejectStatusCode is the status code of the rejected webhook requests
+	// should be either 429 or 503
+	RejectStatusCode int `yaml:"rejectStatusCode"`
 }
 
 type Metric struct {
@@ -39,29 +171,131 @@ type Metric struct {
 	Filter    string          `yaml:"filter"`
 	Operation MetricOperation `yaml:"operation"`
 	Value     string          `yaml:"value"`
-	Labels    []Label         `yaml:"labels"`
-	Type      MetricType      `yaml:"type"`
+	Aggregate Aggregation     `yaml:"aggregate"`
+	// Timestamp is the jq expression of the sample timestamp, it should result
+	// in epoch seconds or RFC3339 string
+	Timestamp string `yaml:"timestamp"`
+	// NameFrom is the jq expression of the metric name, metrics are created
+	// for each name and name must be one of AllowedNames or match AllowedNamesRegex
+	NameFrom          string   `yaml:"nameFrom"`
+	AllowedNames      []string `yaml:"allowedNames"`
+	AllowedNamesRegex string   `yaml:"allowedNamesRegex"`
+	Labels            []Label  `yaml:"labels"`
+	// LabelsFrom is the jq expression resulting in an object of additional
+	// labels, sanitized keys must be one of AllowedLabels or match AllowedLabelsRegex
+	LabelsFrom         string     `yaml:"labelsFrom"`
+	AllowedLabels      []string   `yaml:"allowedLabels"`
+	AllowedLabelsRegex string     `yaml:"allowedLabelsRegex"`
+	Type               MetricType `yaml:"type"`
+	// RelabelConfigs rewrite or drop label sets after labels are extracted
+	RelabelConfigs []RelabelConfig `yaml:"relabelConfigs"`
+	// series not updated within TTL are removed, 0 means series never expire
+	TTL time.Duration `yaml:"ttl"`
+	// MaxSeries limits the number of series of the metric, 0 means no limit.
+	// once limit is reached samples of new series are handled as per Overflow
+	MaxSeries int            `yaml:"maxSeries"`
+	Overflow  OverflowAction `yaml:"overflow"`
+	// OverflowValue is the value of all labels of the overflow series
+	OverflowValue string `yaml:"overflowValue"`
+	// MaxLabelCombinations limits the number of label sets produced by
+	// expand labels for a single json object
+	MaxLabelCombinations int `yaml:"maxLabelCombinations"`
+
+	// histogram buckets, only one of the bucket options can be set
+	Buckets            []float64           `yaml:"buckets"`
+	LinearBuckets      *LinearBuckets      `yaml:"linearBuckets"`
+	ExponentialBuckets *ExponentialBuckets `yaml:"exponentialBuckets"`
+
+	// native histogram options, native histogram is enabled if bucket factor
+	// is set. classic buckets are only exposed alongside if explicitly configured.
+	NativeHistogramBucketFactor    float64 `yaml:"nativeHistogramBucketFactor"`
+	NativeHistogramMaxBucketNumber uint32  `yaml:"nativeHistogramMaxBucketNumber"`
+	NativeHistogramZeroThreshold   float64 `yaml:"nativeHistogramZeroThreshold"`
+
+	// summary options
+	Objectives map[float64]float64 `yaml:"objectives"`
+	MaxAge     time.Duration       `yaml:"maxAge"`
+	AgeBuckets uint32              `yaml:"ageBuckets"`
+
+	// stateset options, list of all the possible states of the metric
+	States []string `yaml:"states"`
+}
+
+// LinearBuckets creates 'count' buckets, each 'width' wide, where the lowest
+// bucket has an upper bound of 'start'.
+type LinearBuckets struct {
+	Start float64 `yaml:"start"`
+	Width float64 `yaml:"width"`
+	Count int     `yaml:"count"`
+}
+
+// ExponentialBuckets creates 'count' buckets, where the lowest bucket has an
+// upper bound of 'start' and each following bucket's upper bound is 'factor'
+// times the previous bucket's upper bound.
+type ExponentialBuckets struct {
+	Start  float64 `yaml:"start"`
+	Factor float64 `yaml:"factor"`
+	Count  int     `yaml:"count"`
 }
 
 type Label struct {
 	Name  string `yaml:"name"`
 	Value string `yaml:"value"`
+	// Expand creates separate series for each output of the value expression
+	// instead of using only first output
+	Expand bool `yaml:"expand"`
 }
 
-func loadCollectors(configPath string) (map[string]*Collector, error) {
+// loadCollectors parses the config, dir is the directory of the config file
+func loadCollectors(data []byte, dir string) (map[string]*Collector, error) {
 	var config Config
-	data, err := os.ReadFile(configPath)
-	if err != nil {
+	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	jqc, err := jq.NewCompiler(config.JQ, config.Variables, dir)
+	if err != nil {
 		return nil, err
 	}
 
+	for id, collector := range config.Collectors {
+		if collector != nil {
+			collector.id = id
+			collector.jq = jqc
+		}
+	}
+
 	return config.Collectors, validateConfig(config)
 }
 
+// compiler returns jq compiler of the collector
+func (c *Collector) compiler() *jq.Compiler {
+	if c.jq == nil {
+		return &jq.Compiler{}
+	}
+	return c.jq
+}
+
+// setCollectorDefaults sets collector level defaults on the metric
+func setCollectorDefaults(c *Collector, m Metric) Metric {
+	if m.TTL == 0 {
+		m.TTL = c.TTL
+	}
+
+	if m.MaxSeries == 0 {
+		m.MaxSeries = c.MaxSeries
+	}
+
+	if m.Overflow == "" {
+		m.Overflow = c.Overflow
+	}
+
+	if m.OverflowValue == "" {
+		m.OverflowValue = c.OverflowValue
+	}
+	return m
+}
+
 func setDefaults(m Metric) Metric {
 	if m.Help == "" {
 		m.Help = fmt.Sprintf("json_exporter metric:%s", m.Name)
@@ -74,21 +308,426 @@ func setDefaults(m Metric) Metric {
 	if m.Value == "" {
 		m.Value = "1"
 	}
+
+	if m.Aggregate == "" {
+		m.Aggregate = AggregateFirst
+	}
+
+	if m.Overflow == "" {
+		m.Overflow = OverflowDrop
+	}
+
+	if m.OverflowValue == "" {
+		m.OverflowValue = defaultOverflowValue
+	}
+
+	if m.MaxLabelCombinations == 0 {
+		m.MaxLabelCombinations = defaultMaxLabelCombinations
+	}
 	return m
 }
 
+// fingerprint returns the config of the metric along with collector's config
+// shared by the metric, metrics with the same fingerprint are identical.
+func fingerprint(c *Collector, m *Metric) string {
+	data, err := yaml.Marshal(struct {
+		Namespace      string
+		DefaultLabels  []Label
+		RelabelConfigs []RelabelConfig
+		JQ             jq.Config
+		Variables      map[string]any
+		Metric         *Metric
+	}{c.Namespace, c.DefaultLabels, c.RelabelConfigs, c.compiler().Config(), c.compiler().Variables(), m})
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
 func validateConfig(config Config) error {
+	return errors.Join(configErrors(config)...)
+}
+
+// configErrors returns all the errors of the config, collectors are
+// validated in the order of their ids
+func configErrors(config Config) []error {
+	var errs []error
+
 	// metrics name must be unique per collector
 	names := make(map[string]bool)
-	for name, c := range config.Collectors {
+	for _, name := range slices.Sorted(maps.Keys(config.Collectors)) {
+		c := config.Collectors[name]
+		if c == nil {
+			errs = append(errs, fmt.Errorf("empty collector config collector:%s", name))
+			continue
+		}
+		if err := validateCollector(c); err != nil {
+			errs = append(errs, fmt.Errorf("invalid collector config collector:%s err:%w", name, err))
+		}
 		for _, m := range c.Metrics {
+			if m == nil {
+				errs = append(errs, fmt.Errorf("empty metric config collector:%s", name))
+				continue
+			}
 			if _, ok := names[c.Namespace+"_"+m.Name]; ok {
-				return fmt.Errorf("metrics name must be unique duplicate names found collector:%s namespace:%s metric:%s",
-					name, c.Namespace, m.Name)
+				errs = append(errs, fmt.Errorf("metrics name must be unique duplicate names found collector:%s namespace:%s metric:%s",
+					name, c.Namespace, m.Name))
 			}
 			names[c.Namespace+"_"+m.Name] = true
+
+			if err := validateMetric(c, m); err != nil {
+				errs = append(errs, fmt.Errorf("invalid metric config collector:%s metric:%s err:%w", name, m.Name, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateCollector(c *Collector) error {
+	labelNames := make(map[string]bool)
+	for _, l := range c.DefaultLabels {
+		if err := validateLabelName(l.Name); err != nil {
+			return err
+		}
+		if labelNames[l.Name] {
+			return fmt.Errorf("default label names must be unique duplicate found label:%s", l.Name)
+		}
+		labelNames[l.Name] = true
+	}
+	for i, rc := range c.RelabelConfigs {
+		if err := validateRelabelConfig(rc); err != nil {
+			return fmt.Errorf("invalid relabel config index:%d err:%w", i, err)
+		}
+	}
+
+	if c.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("maxSeries must not be negative")
+	}
+	if err := validateOverflowAction(c.Overflow); err != nil {
+		return err
+	}
+
+	if c.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+	switch c.Ordering {
+	case "", OrderingNone:
+	case OrderingStrict:
+		if c.Workers > 1 {
+			return fmt.Errorf("strict ordering only supports single worker")
+		}
+	case OrderingPerKey:
+		if c.OrderingKey == "" {
+			return fmt.Errorf("orderingKey is required with perKey ordering")
+		}
+	default:
+		return fmt.Errorf("unknown ordering:%s", c.Ordering)
+	}
+	if c.OrderingKey != "" && c.Ordering != OrderingPerKey {
+		return fmt.Errorf("orderingKey is only supported with perKey ordering")
+	}
+
+	if c.Queue.Size < 0 {
+		return fmt.Errorf("queue size must not be negative")
+	}
+	switch c.Queue.Policy {
+	case "", QueueBlock, QueueDropNewest, QueueDropOldest, QueueReject:
+	default:
+		return fmt.Errorf("unknown queue policy:%s", c.Queue.Policy)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	switch c.OnError {
+	case "", OnErrorSkipObject, OnErrorSkipMetric, OnErrorAbort:
+	default:
+		return fmt.Errorf("unknown onError policy:%s", c.OnError)
+	}
+	switch c.OnNullIteration {
+	case "", NullIterationIgnore, NullIterationError:
+	default:
+		return fmt.Errorf("unknown onNullIteration policy:%s", c.OnNullIteration)
+	}
+
+	if c.Dedup != nil {
+		if err := c.Dedup.Validate(); err != nil {
+			return err
 		}
 	}
 
+	switch c.Queue.RejectStatusCode {
+	case 0:
+	case 429, 503:
+		if c.Queue.Policy != QueueReject {
+			return fmt.Errorf("rejectStatusCode is only supported with reject queue policy")
+		}
+	default:
+		return fmt.Errorf("rejectStatusCode should be either 429 or 503")
+	}
 	return nil
 }
+
+func validateMetric(c *Collector, m *Metric) error {
+	if m.NameFrom == "" && !metricNameRegex.MatchString(prometheus.BuildFQName(c.Namespace, "", m.Name)) {
+		return fmt.Errorf("invalid metric name:%s", prometheus.BuildFQName(c.Namespace, "", m.Name))
+	}
+
+	// names of default labels are validated with the collector
+	labelNames := make(map[string]bool)
+	for _, l := range c.DefaultLabels {
+		labelNames[l.Name] = true
+	}
+	for _, l := range m.Labels {
+		if err := validateLabelName(l.Name); err != nil {
+			return err
+		}
+		if labelNames[l.Name] {
+			return fmt.Errorf("label names must be unique duplicate found label:%s", l.Name)
+		}
+		labelNames[l.Name] = true
+	}
+	if m.Type == HistogramMetric && labelNames["le"] {
+		return fmt.Errorf("label name le is reserved for histogram metrics")
+	}
+	if m.Type == SummaryMetric && labelNames["quantile"] {
+		return fmt.Errorf("label name quantile is reserved for summary metrics")
+	}
+
+	switch m.Type {
+	case "", CounterMetric, GaugeMetric, HistogramMetric, SummaryMetric:
+	case InfoMetric:
+		if m.Value != "" {
+			return fmt.Errorf("value is not supported for info metrics")
+		}
+	case StateSetMetric:
+		if len(m.States) == 0 {
+			return fmt.Errorf("states are required for stateset metrics")
+		}
+		// state is exposed as label with the name of the metric
+		for _, l := range append(c.DefaultLabels, m.Labels...) {
+			if l.Name == m.Name {
+				return fmt.Errorf("label name must not be same as stateset metric name label:%s", l.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown metric type:%s", m.Type)
+	}
+
+	switch m.Operation {
+	case "":
+	case OperationAdd, OperationSet:
+		if m.Type != "" && m.Type != CounterMetric && m.Type != GaugeMetric {
+			return fmt.Errorf("operation is only supported for counter and gauge metrics")
+		}
+	default:
+		return fmt.Errorf("unknown operation:%s", m.Operation)
+	}
+
+	switch m.Aggregate {
+	case "", AggregateFirst:
+	case AggregateLast, AggregateSum, AggregateCount, AggregateMin, AggregateMax, AggregateAvg:
+		if m.Type == InfoMetric || m.Type == StateSetMetric {
+			return fmt.Errorf("aggregate is not supported for %s metrics", m.Type)
+		}
+	default:
+		return fmt.Errorf("unknown aggregate:%s", m.Aggregate)
+	}
+
+	if m.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+
+	if m.NameFrom == "" && (len(m.AllowedNames) > 0 || m.AllowedNamesRegex != "") {
+		return fmt.Errorf("allowedNames and allowedNamesRegex are only supported with nameFrom")
+	}
+	if m.NameFrom != "" {
+		if m.Type == StateSetMetric {
+			return fmt.Errorf("nameFrom is not supported for stateset metrics")
+		}
+		if len(m.AllowedNames) == 0 && m.AllowedNamesRegex == "" {
+			return fmt.Errorf("allowedNames or allowedNamesRegex is required with nameFrom")
+		}
+		for _, n := range m.AllowedNames {
+			if !metricNameRegex.MatchString(n) {
+				return fmt.Errorf("invalid allowed metric name:%s", n)
+			}
+		}
+		if _, err := regexp.Compile(m.AllowedNamesRegex); err != nil {
+			return fmt.Errorf("invalid allowedNamesRegex err:%w", err)
+		}
+	}
+
+	if m.LabelsFrom == "" && (len(m.AllowedLabels) > 0 || m.AllowedLabelsRegex != "") {
+		return fmt.Errorf("allowedLabels and allowedLabelsRegex are only supported with labelsFrom")
+	}
+	if m.LabelsFrom != "" {
+		if len(m.AllowedLabels) == 0 && m.AllowedLabelsRegex == "" {
+			return fmt.Errorf("allowedLabels or allowedLabelsRegex is required with labelsFrom")
+		}
+		for _, n := range m.AllowedLabels {
+			if !labelNameRegex.MatchString(n) || strings.HasPrefix(n, "__") {
+				return fmt.Errorf("invalid allowed label name:%s", n)
+			}
+			if isReservedLabel(m.Type, m.Name, n) {
+				return fmt.Errorf("allowed label name is reserved for %s metrics label:%s", m.Type, n)
+			}
+		}
+		if _, err := regexp.Compile(m.AllowedLabelsRegex); err != nil {
+			return fmt.Errorf("invalid allowedLabelsRegex err:%w", err)
+		}
+	}
+
+	for i, rc := range m.RelabelConfigs {
+		if err := validateRelabelConfig(rc); err != nil {
+			return fmt.Errorf("invalid relabel config index:%d err:%w", i, err)
+		}
+	}
+
+	if m.MaxSeries < 0 {
+		return fmt.Errorf("maxSeries must not be negative")
+	}
+	if err := validateOverflowAction(m.Overflow); err != nil {
+		return err
+	}
+
+	if m.MaxLabelCombinations < 0 {
+		return fmt.Errorf("maxLabelCombinations must not be negative")
+	}
+
+	if len(m.States) > 0 && m.Type != StateSetMetric {
+		return fmt.Errorf("states are only supported for stateset metrics")
+	}
+	states := make(map[string]bool)
+	for _, s := range m.States {
+		if states[s] {
+			return fmt.Errorf("states must be unique duplicate found state:%s", s)
+		}
+		states[s] = true
+	}
+
+	var bucketOpts int
+	if len(m.Buckets) > 0 {
+		bucketOpts++
+	}
+	if m.LinearBuckets != nil {
+		bucketOpts++
+	}
+	if m.ExponentialBuckets != nil {
+		bucketOpts++
+	}
+
+	if bucketOpts > 0 && m.Type != HistogramMetric {
+		return fmt.Errorf("buckets are only supported for histogram metrics")
+	}
+	if bucketOpts > 1 {
+		return fmt.Errorf("only one of buckets, linearBuckets or exponentialBuckets can be set")
+	}
+
+	for i := 1; i < len(m.Buckets); i++ {
+		if m.Buckets[i] <= m.Buckets[i-1] {
+			return fmt.Errorf("buckets must be in increasing order")
+		}
+	}
+
+	if lb := m.LinearBuckets; lb != nil {
+		if lb.Count < 1 {
+			return fmt.Errorf("linearBuckets count must be positive")
+		}
+		if lb.Width <= 0 {
+			return fmt.Errorf("linearBuckets width must be positive")
+		}
+	}
+
+	if eb := m.ExponentialBuckets; eb != nil {
+		if eb.Count < 1 {
+			return fmt.Errorf("exponentialBuckets count must be positive")
+		}
+		if eb.Start <= 0 {
+			return fmt.Errorf("exponentialBuckets start must be positive")
+		}
+		if eb.Factor <= 1 {
+			return fmt.Errorf("exponentialBuckets factor must be greater than 1")
+		}
+	}
+
+	native := m.NativeHistogramBucketFactor != 0
+	if (native || m.NativeHistogramMaxBucketNumber != 0 || m.NativeHistogramZeroThreshold != 0) && m.Type != HistogramMetric {
+		return fmt.Errorf("native histogram options are only supported for histogram metrics")
+	}
+	if native && m.NativeHistogramBucketFactor <= 1 {
+		return fmt.Errorf("nativeHistogramBucketFactor must be greater than 1")
+	}
+	if !native && (m.NativeHistogramMaxBucketNumber != 0 || m.NativeHistogramZeroThreshold != 0) {
+		return fmt.Errorf("nativeHistogramMaxBucketNumber and nativeHistogramZeroThreshold require nativeHistogramBucketFactor")
+	}
+	if m.NativeHistogramZeroThreshold < 0 {
+		return fmt.Errorf("nativeHistogramZeroThreshold must not be negative")
+	}
+
+	if (len(m.Objectives) > 0 || m.MaxAge != 0 || m.AgeBuckets != 0) && m.Type != SummaryMetric {
+		return fmt.Errorf("objectives, maxAge and ageBuckets are only supported for summary metrics")
+	}
+	for q, e := range m.Objectives {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("objective quantile must be between 0 and 1 quantile:%v", q)
+		}
+		if e < 0 || e > 1 {
+			return fmt.Errorf("objective error must be between 0 and 1 quantile:%v error:%v", q, e)
+		}
+	}
+	if m.MaxAge < 0 {
+		return fmt.Errorf("maxAge must not be negative")
+	}
+
+	return nil
+}
+
+// validateLabelName returns error if prometheus would reject the label name
+func validateLabelName(name string) error {
+	if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("invalid label name:%q", name)
+	}
+	return nil
+}
+
+// isReservedLabel returns true if the label name is reserved by the metric
+// type, state of stateset metrics is exposed as label with the metric name
+func isReservedLabel(t MetricType, metricName, label string) bool {
+	switch t {
+	case HistogramMetric:
+		return label == "le"
+	case SummaryMetric:
+		return label == "quantile"
+	case StateSetMetric:
+		return label == metricName
+	default:
+		return false
+	}
+}
+
+func validateOverflowAction(a OverflowAction) error {
+	switch a {
+	case "", OverflowDrop, OverflowFold:
+		return nil
+	default:
+		return fmt.Errorf("unknown overflow action:%s", a)
+	}
+}
+
+// histogramBuckets returns the configured buckets of the histogram metric,
+// nil is returned if no buckets are configured so that defaults are used.
+// defaults are not used for native histograms.
+func (m Metric) histogramBuckets() []float64 {
+	switch {
+	case m.LinearBuckets != nil:
+		return prometheus.LinearBuckets(m.LinearBuckets.Start, m.LinearBuckets.Width, m.LinearBuckets.Count)
+	case m.ExponentialBuckets != nil:
+		return prometheus.ExponentialBuckets(m.ExponentialBuckets.Start, m.ExponentialBuckets.Factor, m.ExponentialBuckets.Count)
+	default:
+		return m.Buckets
+	}
+}
@@ -2,8 +2,10 @@ package collector
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/utilitywarehouse/json_exporter/dedup"
 )
 
 func Test_setDefaults(t *testing.T) {
@@ -19,13 +21,19 @@ func Test_setDefaults(t *testing.T) {
 			"",
 			args{Metric{Name: "value_count"}},
 			Metric{
-				Name:   "value_count",
-				Help:   "json_exporter metric:value_count",
-				Path:   "",
-				Filter: "",
-				Value:  "1",
-				Labels: nil,
-				Type:   "counter",
+				Name:      "value_count",
+				Help:      "json_exporter metric:value_count",
+				Path:      "",
+				Filter:    "",
+				Value:     "1",
+				Aggregate: "first",
+				Labels:    nil,
+				Type:      "counter",
+
+				Overflow:      "drop",
+				OverflowValue: "__other__",
+
+				MaxLabelCombinations: 100,
 			},
 		},
 	}
@@ -112,3 +120,183 @@ func Test_validateConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateCollector(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *Collector
+		wantErr bool
+	}{
+		{"empty", &Collector{}, false},
+		{"negative-ttl", &Collector{TTL: -time.Minute}, true},
+		{"workers", &Collector{Workers: 5}, false},
+		{"negative-workers", &Collector{Workers: -1}, true},
+		{"ordering-none", &Collector{Workers: 5, Ordering: OrderingNone}, false},
+		{"ordering-strict", &Collector{Ordering: OrderingStrict}, false},
+		{"ordering-strict-workers", &Collector{Workers: 5, Ordering: OrderingStrict}, true},
+		{"ordering-per-key", &Collector{Workers: 5, Ordering: OrderingPerKey, OrderingKey: ".id"}, false},
+		{"ordering-per-key-no-key", &Collector{Ordering: OrderingPerKey}, true},
+		{"ordering-key-without-per-key", &Collector{OrderingKey: ".id"}, true},
+		{"unknown-ordering", &Collector{Ordering: "random"}, true},
+		{"timeout", &Collector{Timeout: time.Second, OnError: OnErrorAbort, OnNullIteration: NullIterationError}, false},
+		{"negative-timeout", &Collector{Timeout: -time.Second}, true},
+		{"unknown-on-error", &Collector{OnError: "retry"}, true},
+		{"unknown-on-null-iteration", &Collector{OnNullIteration: "skip"}, true},
+		{"dedup", &Collector{Dedup: &dedup.Config{Key: ".uuid", TTL: time.Hour}}, false},
+		{"dedup-no-key", &Collector{Dedup: &dedup.Config{TTL: time.Hour}}, true},
+		{"queue", &Collector{Queue: Queue{Size: 10, Policy: QueueDropOldest}}, false},
+		{"queue-negative-size", &Collector{Queue: Queue{Size: -1}}, true},
+		{"queue-unknown-policy", &Collector{Queue: Queue{Policy: "drop"}}, true},
+		{"queue-reject", &Collector{Queue: Queue{Policy: QueueReject, RejectStatusCode: 503}}, false},
+		{"queue-reject-invalid-code", &Collector{Queue: Queue{Policy: QueueReject, RejectStatusCode: 500}}, true},
+		{"queue-reject-code-without-reject", &Collector{Queue: Queue{Policy: QueueBlock, RejectStatusCode: 429}}, true},
+		{"default-labels", &Collector{DefaultLabels: []Label{{Name: "env"}, {Name: "app"}}}, false},
+		{"default-labels-invalid-name", &Collector{DefaultLabels: []Label{{Name: "app-name"}}}, true},
+		{"default-labels-reserved-name", &Collector{DefaultLabels: []Label{{Name: "__name__"}}}, true},
+		{"default-labels-duplicate", &Collector{DefaultLabels: []Label{{Name: "env"}, {Name: "env"}}}, true},
+		{"relabel-configs", &Collector{RelabelConfigs: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "dev", Action: RelabelDrop}}}, false},
+		{"relabel-configs-invalid", &Collector{RelabelConfigs: []RelabelConfig{{Action: "labelkeep"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCollector(tt.c); (err != nil) != tt.wantErr {
+				t.Errorf("validateCollector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *Metric
+		wantErr bool
+	}{
+		{"counter", &Metric{Name: "m"}, false},
+		{"histogram-default-buckets", &Metric{Name: "m", Type: HistogramMetric}, false},
+		{"histogram-buckets", &Metric{Name: "m", Type: HistogramMetric, Buckets: []float64{0.1, 1, 10}}, false},
+		{"histogram-unordered-buckets", &Metric{Name: "m", Type: HistogramMetric, Buckets: []float64{1, 0.1}}, true},
+		{"histogram-linear", &Metric{Name: "m", Type: HistogramMetric, LinearBuckets: &LinearBuckets{0, 10, 5}}, false},
+		{"histogram-linear-no-count", &Metric{Name: "m", Type: HistogramMetric, LinearBuckets: &LinearBuckets{0, 10, 0}}, true},
+		{"histogram-exponential", &Metric{Name: "m", Type: HistogramMetric, ExponentialBuckets: &ExponentialBuckets{1, 2, 5}}, false},
+		{"histogram-exponential-bad-factor", &Metric{Name: "m", Type: HistogramMetric, ExponentialBuckets: &ExponentialBuckets{1, 1, 5}}, true},
+		{"histogram-multiple-buckets", &Metric{
+			Name: "m", Type: HistogramMetric,
+			Buckets: []float64{1}, LinearBuckets: &LinearBuckets{0, 10, 5},
+		}, true},
+		{"gauge-with-buckets", &Metric{Name: "m", Type: GaugeMetric, Buckets: []float64{1}}, true},
+		{"native-histogram", &Metric{Name: "m", Type: HistogramMetric, NativeHistogramBucketFactor: 1.1, NativeHistogramMaxBucketNumber: 100}, false},
+		{"native-histogram-bad-factor", &Metric{Name: "m", Type: HistogramMetric, NativeHistogramBucketFactor: 0.5}, true},
+		{"native-histogram-no-factor", &Metric{Name: "m", Type: HistogramMetric, NativeHistogramZeroThreshold: 0.001}, true},
+		{"gauge-with-native-histogram", &Metric{Name: "m", Type: GaugeMetric, NativeHistogramBucketFactor: 1.1}, true},
+		{"unknown-type", &Metric{Name: "m", Type: "random"}, true},
+		{"info", &Metric{Name: "m_info", Type: InfoMetric, Labels: []Label{{Name: "version", Value: ".version"}}}, false},
+		{"info-with-value", &Metric{Name: "m_info", Type: InfoMetric, Value: ".count"}, true},
+		{"stateset", &Metric{Name: "state", Type: StateSetMetric, States: []string{"a", "b"}}, false},
+		{"stateset-no-states", &Metric{Name: "state", Type: StateSetMetric}, true},
+		{"stateset-duplicate-states", &Metric{Name: "state", Type: StateSetMetric, States: []string{"a", "a"}}, true},
+		{"stateset-label-conflict", &Metric{Name: "state", Type: StateSetMetric, States: []string{"a"}, Labels: []Label{{Name: "state", Value: ".s"}}}, true},
+		{"stateset-default-label-conflict", &Metric{Name: "env", Type: StateSetMetric, States: []string{"a"}}, true},
+		{"gauge-with-states", &Metric{Name: "state", Type: GaugeMetric, States: []string{"a"}}, true},
+		{"labels-from-reserved-histogram", &Metric{Name: "m", Type: HistogramMetric, LabelsFrom: ".tags", AllowedLabels: []string{"le"}}, true},
+		{"labels-from-reserved-summary", &Metric{Name: "m", Type: SummaryMetric, LabelsFrom: ".tags", AllowedLabels: []string{"quantile"}}, true},
+		{"labels-from-reserved-stateset", &Metric{Name: "state", Type: StateSetMetric, States: []string{"a"}, LabelsFrom: ".tags", AllowedLabels: []string{"state"}}, true},
+		{"relabel-configs", &Metric{Name: "m", RelabelConfigs: []RelabelConfig{{Regex: "tmp_.*", Action: RelabelLabelDrop}}}, false},
+		{"relabel-configs-invalid-regex", &Metric{Name: "m", RelabelConfigs: []RelabelConfig{{Regex: "(", Action: RelabelLabelDrop}}}, true},
+		{"max-series", &Metric{Name: "m", MaxSeries: 10, Overflow: OverflowFold}, false},
+		{"max-series-negative", &Metric{Name: "m", MaxSeries: -1}, true},
+		{"unknown-overflow", &Metric{Name: "m", MaxSeries: 10, Overflow: "random"}, true},
+		{"counter-set", &Metric{Name: "m", Operation: OperationSet}, false},
+		{"gauge-add", &Metric{Name: "m", Type: GaugeMetric, Operation: OperationAdd}, false},
+		{"unknown-operation", &Metric{Name: "m", Operation: "inc"}, true},
+		{"histogram-operation", &Metric{Name: "m", Type: HistogramMetric, Operation: OperationSet}, true},
+		{"name-from", &Metric{Name: "m", NameFrom: ".name", AllowedNames: []string{"a_total"}}, false},
+		{"name-from-regex", &Metric{Name: "m", NameFrom: ".name", AllowedNamesRegex: "a_.*"}, false},
+		{"name-from-no-allow-list", &Metric{Name: "m", NameFrom: ".name"}, true},
+		{"name-from-invalid-allowed-name", &Metric{Name: "m", NameFrom: ".name", AllowedNames: []string{"a-total"}}, true},
+		{"name-from-invalid-regex", &Metric{Name: "m", NameFrom: ".name", AllowedNamesRegex: "a_(.*"}, true},
+		{"name-from-stateset", &Metric{Name: "m", Type: StateSetMetric, States: []string{"a"}, NameFrom: ".name", AllowedNames: []string{"a"}}, true},
+		{"allowed-names-without-name-from", &Metric{Name: "m", AllowedNames: []string{"a"}}, true},
+		{"labels-from", &Metric{Name: "m", LabelsFrom: ".tags", AllowedLabels: []string{"team"}}, false},
+		{"labels-from-regex", &Metric{Name: "m", LabelsFrom: ".tags", AllowedLabelsRegex: "tag_.*"}, false},
+		{"labels-from-no-allow-list", &Metric{Name: "m", LabelsFrom: ".tags"}, true},
+		{"labels-from-invalid-allowed-label", &Metric{Name: "m", LabelsFrom: ".tags", AllowedLabels: []string{"team-name"}}, true},
+		{"labels-from-reserved-allowed-label", &Metric{Name: "m", LabelsFrom: ".tags", AllowedLabels: []string{"__name__"}}, true},
+		{"labels-from-invalid-regex", &Metric{Name: "m", LabelsFrom: ".tags", AllowedLabelsRegex: "tag_(.*"}, true},
+		{"allowed-labels-without-labels-from", &Metric{Name: "m", AllowedLabels: []string{"team"}}, true},
+		{"allowed-names-without-name-from", &Metric{Name: "m", AllowedNames: []string{"a"}}, true},
+		{"aggregate", &Metric{Name: "m", Type: GaugeMetric, Aggregate: AggregateSum}, false},
+		{"unknown-aggregate", &Metric{Name: "m", Aggregate: "median"}, true},
+		{"stateset-aggregate", &Metric{Name: "m", Type: StateSetMetric, States: []string{"a"}, Aggregate: AggregateMax}, true},
+		{"summary", &Metric{Name: "m", Type: SummaryMetric, Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001}, MaxAge: time.Minute, AgeBuckets: 3}, false},
+		{"summary-bad-quantile", &Metric{Name: "m", Type: SummaryMetric, Objectives: map[float64]float64{1.5: 0.05}}, true},
+		{"summary-negative-max-age", &Metric{Name: "m", Type: SummaryMetric, MaxAge: -time.Minute}, true},
+		{"counter-with-objectives", &Metric{Name: "m", Objectives: map[float64]float64{0.5: 0.05}}, true},
+		{"invalid-name", &Metric{Name: "m-total"}, true},
+		{"empty-name", &Metric{}, true},
+		{"invalid-label-name", &Metric{Name: "m", Labels: []Label{{Name: "app.name", Value: ".app"}}}, true},
+		{"reserved-label-name", &Metric{Name: "m", Labels: []Label{{Name: "__app", Value: ".app"}}}, true},
+		{"duplicate-label-name", &Metric{Name: "m", Labels: []Label{{Name: "app", Value: ".a"}, {Name: "app", Value: ".b"}}}, true},
+		{"default-label-name", &Metric{Name: "m", Labels: []Label{{Name: "env", Value: ".env"}}}, true},
+		{"histogram-le-label", &Metric{Name: "m", Type: HistogramMetric, Labels: []Label{{Name: "le", Value: ".le"}}}, true},
+		{"summary-quantile-label", &Metric{Name: "m", Type: SummaryMetric, Labels: []Label{{Name: "quantile", Value: ".q"}}}, true},
+		{"counter-le-label", &Metric{Name: "m", Labels: []Label{{Name: "le", Value: ".le"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMetric(&Collector{DefaultLabels: []Label{{Name: "env", Value: `"beta"`}}}, tt.m); (err != nil) != tt.wantErr {
+				t.Errorf("validateMetric() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetric_histogramBuckets(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Metric
+		want []float64
+	}{
+		{"default", Metric{}, nil},
+		{"values", Metric{Buckets: []float64{1, 2, 3}}, []float64{1, 2, 3}},
+		{"linear", Metric{LinearBuckets: &LinearBuckets{Start: 1, Width: 2, Count: 3}}, []float64{1, 3, 5}},
+		{"exponential", Metric{ExponentialBuckets: &ExponentialBuckets{Start: 1, Factor: 10, Count: 3}}, []float64{1, 10, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.m.histogramBuckets(), tt.want); diff != "" {
+				t.Errorf("histogramBuckets mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_setCollectorDefaults(t *testing.T) {
+	c := &Collector{TTL: time.Hour, MaxSeries: 100, Overflow: OverflowFold, OverflowValue: "other"}
+
+	tests := []struct {
+		name string
+		m    Metric
+		want Metric
+	}{
+		{
+			"inherit",
+			Metric{Name: "m"},
+			Metric{Name: "m", TTL: time.Hour, MaxSeries: 100, Overflow: OverflowFold, OverflowValue: "other"},
+		},
+		{
+			"override",
+			Metric{Name: "m", TTL: time.Minute, MaxSeries: 10, Overflow: OverflowDrop, OverflowValue: "__overflow__"},
+			Metric{Name: "m", TTL: time.Minute, MaxSeries: 10, Overflow: OverflowDrop, OverflowValue: "__overflow__"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := setCollectorDefaults(c, tt.m)
+
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("setCollectorDefaults mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/jq"
+)
+
+var (
+	metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegex  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// reasons of rejecting dynamic metric names
+const (
+	rejectInvalidName  = "invalid_name"
+	rejectNotAllowed   = "not_allowed"
+	rejectRegisterFail = "register_failed"
+)
+
+// dynamicMetrics creates and registers metrics lazily for the names taken from
+// the json objects. all the metrics share help, type and label names.
+type dynamicMetrics struct {
+	nameFrom     *jq.Code
+	allowedNames []string
+	allowedRegex *regexp.Regexp
+
+	metric *Metric
+	reg    *prometheus.Registry
+	ns     string
+
+	mu      sync.Mutex
+	metrics map[string]*jsonMetric
+}
+
+func newDynamicMetrics(metric *Metric, reg *prometheus.Registry, ns string, jqc *jq.Compiler) (*dynamicMetrics, error) {
+	var err error
+
+	d := &dynamicMetrics{
+		allowedNames: metric.AllowedNames,
+		metric:       metric,
+		reg:          reg,
+		ns:           ns,
+		metrics:      make(map[string]*jsonMetric),
+	}
+
+	d.nameFrom, err = jqc.Compile(metric.NameFrom)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse nameFrom expression err:%w", err)
+	}
+
+	if metric.AllowedNamesRegex != "" {
+		d.allowedRegex, err = regexp.Compile("^(?:" + metric.AllowedNamesRegex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse allowedNamesRegex err:%w", err)
+		}
+	}
+
+	return d, nil
+}
+
+// all returns all the created metrics
+func (d *dynamicMetrics) all() []*jsonMetric {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var metrics []*jsonMetric
+	for _, m := range d.metrics {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// activate switches the registry of the metrics to reg, all the created
+// metrics are registered to reg and metrics created later are registered
+// to reg too. it returns number of metrics failed to register.
+func (d *dynamicMetrics) activate(reg *prometheus.Registry) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var failed int
+	for _, m := range d.metrics {
+		var are prometheus.AlreadyRegisteredError
+		if err := reg.Register(m); err != nil && !errors.As(err, &are) {
+			failed++
+		}
+	}
+	d.reg = reg
+	return failed
+}
+
+// allowed returns true if name is in allowed names or matches allowed regex
+func (d *dynamicMetrics) allowed(name string) bool {
+	if slices.Contains(d.allowedNames, name) {
+		return true
+	}
+	return d.allowedRegex != nil && d.allowedRegex.MatchString(name)
+}
+
+// dynamicMetric returns the metric named by the nameFrom expression for the input.
+// metric is created and registered if its new. nil is returned if name is
+// rejected, rejections are counted in exporter metrics.
+func (jm *jsonMetric) dynamicMetric(ctx context.Context, input any) (*jsonMetric, error) {
+	d := jm.dynamic
+
+	v, err := extractFirstValue(ctx, d.nameFrom, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get metric name err:%w", err)
+	}
+
+	return jm.namedMetric(fmt.Sprint(v))
+}
+
+// namedMetric returns the dynamic metric with the given name, metric is
+// created and registered if its new. nil is returned if name is rejected.
+func (jm *jsonMetric) namedMetric(name string) (*jsonMetric, error) {
+	d := jm.dynamic
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if dm, ok := d.metrics[name]; ok {
+		return dm, nil
+	}
+
+	if !metricNameRegex.MatchString(name) {
+		cmu.updateRejectedMetricNames(jm.collector, jm.name, rejectInvalidName)
+		return nil, nil
+	}
+
+	if !d.allowed(name) {
+		cmu.updateRejectedMetricNames(jm.collector, jm.name, rejectNotAllowed)
+		return nil, nil
+	}
+
+	dm := *jm
+	dm.dynamic = nil
+	if err := dm.init(d.metric, d.ns, name); err != nil {
+		return nil, err
+	}
+
+	if err := d.reg.Register(&dm); err != nil {
+		cmu.updateRejectedMetricNames(jm.collector, jm.name, rejectRegisterFail)
+		return nil, nil
+	}
+
+	d.metrics[name] = &dm
+	return &dm, nil
+}
+
+// dynamicLabels extracts additional labels of the metric from the json objects.
+type dynamicLabels struct {
+	labelsFrom    *jq.Code
+	allowedLabels []string
+	allowedRegex  *regexp.Regexp
+	// metricType and metricName are used to skip labels reserved by the metric
+	metricType MetricType
+	metricName string
+}
+
+func newDynamicLabels(metric *Metric, jqc *jq.Compiler) (*dynamicLabels, error) {
+	var err error
+
+	d := &dynamicLabels{
+		allowedLabels: metric.AllowedLabels,
+		metricType:    metric.Type,
+		metricName:    metric.Name,
+	}
+
+	d.labelsFrom, err = jqc.Compile(metric.LabelsFrom)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse labelsFrom expression err:%w", err)
+	}
+
+	if metric.AllowedLabelsRegex != "" {
+		d.allowedRegex, err = regexp.Compile("^(?:" + metric.AllowedLabelsRegex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse allowedLabelsRegex err:%w", err)
+		}
+	}
+
+	return d, nil
+}
+
+// allowed returns true if name is in allowed labels or matches allowed regex
+func (d *dynamicLabels) allowed(name string) bool {
+	if slices.Contains(d.allowedLabels, name) {
+		return true
+	}
+	return d.allowedRegex != nil && d.allowedRegex.MatchString(name)
+}
+
+// extract returns labels from the object resulted by labelsFrom expression.
+// keys are sanitized to valid label names, reserved and not allowed keys and
+// null values are ignored. if multiple keys are sanitized to the same name,
+// value of the key which is already a valid name is used otherwise value of
+// the first key in sorted order.
+func (d *dynamicLabels) extract(ctx context.Context, input any) (prometheus.Labels, error) {
+	v, err := extractFirstValue(ctx, d.labelsFrom, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get labels err:%w", err)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("labelsFrom expression must result in an object got:%T", v)
+	}
+
+	labels := make(prometheus.Labels, len(obj))
+	for _, k := range slices.Sorted(maps.Keys(obj)) {
+		val := obj[k]
+		name := sanitizeLabelName(k)
+		if name == "" || strings.HasPrefix(name, "__") || val == nil || !d.allowed(name) ||
+			isReservedLabel(d.metricType, d.metricName, name) {
+			continue
+		}
+		if _, ok := labels[name]; ok && k != name {
+			continue
+		}
+		labels[name] = fmt.Sprint(val)
+	}
+	return labels, nil
+}
@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/utilitywarehouse/json_exporter/jq"
+)
+
+func TestJSONCollector_process_nameFrom(t *testing.T) {
+	log := slog.Default()
+
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "event_counters", Path: ".[]", Value: ".count",
+				Help:              "Counters of events",
+				NameFrom:          `.name + "_total"`,
+				AllowedNames:      []string{"logins_total"},
+				AllowedNamesRegex: `deploy_.*`,
+				Labels:            []Label{{Name: "app", Value: ".app"}},
+			},
+		},
+	}
+	input := mustParseJson(`
+	[
+		{"name": "logins","app": "a","count": 1},
+		{"name": "logins","app": "b","count": 2},
+		{"name": "deploy_failed","app": "a","count": 3},
+		{"name": "logouts","app": "a","count": 4},
+		{"name": "invalid-name","app": "a","count": 5}
+	]`)
+
+	expected := `test_deploy_failed_total{app="a"} 3
+test_logins_total{app="a"} 1
+test_logins_total{app="b"} 2`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, mf := range gathering {
+		if mf.GetHelp() != "Counters of events" {
+			t.Errorf("dynamic metric %s help = %s, want %s", mf.GetName(), mf.GetHelp(), "Counters of events")
+		}
+	}
+
+	tests := []struct {
+		reason string
+		want   float64
+	}{
+		{rejectNotAllowed, 1},
+		{rejectInvalidName, 1},
+		{rejectRegisterFail, 0},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(cm.rejectedNames.WithLabelValues("events", "event_counters", tt.reason))
+		if got != tt.want {
+			t.Errorf("rejected metric names reason:%s = %v, want %v", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func Test_dynamicMetrics_registerConflict(t *testing.T) {
+	log := slog.Default()
+
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "static_total", Value: ".count",
+			},
+			{
+				Name: "event_counters", Value: ".count",
+				NameFrom:          `.name`,
+				AllowedNamesRegex: `.*_total`,
+				Labels:            []Label{{Name: "app", Value: ".app"}},
+			},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	// name conflicts with static metric with different labels
+	collector.process(context.Background(), mustParseJson(`{"name": "static_total","app": "a","count": 1}`))
+
+	got := testutil.ToFloat64(cm.rejectedNames.WithLabelValues("events", "event_counters", rejectRegisterFail))
+	if got != 1 {
+		t.Errorf("rejected metric names = %v, want %v", got, 1)
+	}
+}
+
+func TestJSONCollector_process_labelsFrom(t *testing.T) {
+	log := slog.Default()
+
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "event_count", Path: ".[]", Value: ".count",
+				Labels:             []Label{{Name: "app", Value: ".app"}},
+				LabelsFrom:         ".tags",
+				AllowedLabels:      []string{"team", "app"},
+				AllowedLabelsRegex: `tag_.*`,
+			},
+			{
+				Name: "event_duration_seconds", Path: ".[]", Value: ".duration", Type: HistogramMetric,
+				Buckets:       []float64{1},
+				LabelsFrom:    ".tags",
+				AllowedLabels: []string{"team"},
+			},
+		},
+	}
+	input := mustParseJson(`
+	[
+		{"app": "a", "count": 1, "duration": 0.5},
+		{"app": "a", "count": 2, "duration": 0.5, "tags": {"team": "x", "tag-env": "prod", "__name__": "y", "other": "z"}},
+		{"app": "b", "count": 3, "duration": 2, "tags": {"team": "x", "app": "c", "tag_env": null}},
+		{"app": "a", "count": 4, "duration": 2, "tags": {"team": "x", "tag_env": "prod"}}
+	]`)
+
+	expected := `test_event_count{app="a"} 1
+test_event_count{app="b",team="x"} 3
+test_event_count{app="a",tag_env="prod",team="x"} 6
+test_event_duration_seconds_bucket{le="1"} 1
+test_event_duration_seconds_bucket{le="+Inf"} 1
+test_event_duration_seconds_sum 0.5
+test_event_duration_seconds_count 1
+test_event_duration_seconds_bucket{team="x",le="1"} 1
+test_event_duration_seconds_bucket{team="x",le="+Inf"} 3
+test_event_duration_seconds_sum{team="x"} 4.5
+test_event_duration_seconds_count{team="x"} 3`
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("JSONCollector.process() error = %v", err)
+	}
+
+	if got := collector.process(context.Background(), input); !got {
+		t.Errorf("JSONCollector.process() = %v, want %v", got, true)
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_dynamicLabels_extract(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric *Metric
+		input  string
+		want   prometheus.Labels
+	}{
+		{"histogram-le",
+			&Metric{Name: "m", Type: HistogramMetric, LabelsFrom: ".tags", AllowedLabelsRegex: ".*"},
+			`{"tags": {"le": "x", "team": "a"}}`, prometheus.Labels{"team": "a"}},
+		{"summary-quantile",
+			&Metric{Name: "m", Type: SummaryMetric, LabelsFrom: ".tags", AllowedLabelsRegex: ".*"},
+			`{"tags": {"quantile": "x", "team": "a"}}`, prometheus.Labels{"team": "a"}},
+		{"stateset-name",
+			&Metric{Name: "state", Type: StateSetMetric, LabelsFrom: ".tags", AllowedLabelsRegex: ".*"},
+			`{"tags": {"state": "x", "team": "a"}}`, prometheus.Labels{"team": "a"}},
+		{"counter-le",
+			&Metric{Name: "m", Type: CounterMetric, LabelsFrom: ".tags", AllowedLabelsRegex: ".*"},
+			`{"tags": {"le": "x"}}`, prometheus.Labels{"le": "x"}},
+		{"sanitize-collision-valid-name",
+			&Metric{Name: "m", Type: CounterMetric, LabelsFrom: ".tags", AllowedLabels: []string{"app_name"}},
+			`{"tags": {"app.name": "a", "app_name": "b", "app-name": "c"}}`, prometheus.Labels{"app_name": "b"}},
+		{"sanitize-collision-sorted",
+			&Metric{Name: "m", Type: CounterMetric, LabelsFrom: ".tags", AllowedLabels: []string{"app_name"}},
+			`{"tags": {"app.name": "a", "app-name": "c"}}`, prometheus.Labels{"app_name": "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDynamicLabels(tt.metric, &jq.Compiler{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// map iteration order is random, collisions must resolve the same way every time
+			for range 10 {
+				got, err := d.extract(context.Background(), mustParseJson(tt.input))
+				if err != nil {
+					t.Fatalf("dynamicLabels.extract() error = %v", err)
+				}
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Fatalf("dynamicLabels.extract() mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/itchyny/gojq"
+)
+
+// classes of the collection errors
+const (
+	errClassNullIteration = "null_iteration"
+	errClassPath          = "path"
+	errClassFilter        = "filter"
+	errClassName          = "name"
+	errClassLabels        = "labels"
+	errClassTimestamp     = "timestamp"
+	errClassValue         = "value"
+	errClassTimeout       = "timeout"
+)
+
+// collectError is an error of collecting metric from the json object
+type collectError struct {
+	class string
+	err   error
+}
+
+func (e *collectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *collectError) Unwrap() error {
+	return e.err
+}
+
+// errorClass returns class of the collection error, errors without class
+// are errors of the metric value
+func errorClass(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errClassTimeout
+	}
+
+	var cErr *collectError
+	if errors.As(err, &cErr) {
+		return cErr.class
+	}
+	return errClassValue
+}
+
+// nullIteration is the error returned by gojq when iterating over null, gojq
+// doesn't export the error type so the error of such a query is used to match
+// both its type and its message. Test_isNullIteration guards against changes
+// of the error by gojq upgrades.
+var nullIteration = func() error {
+	query, err := gojq.Parse(".[]")
+	if err != nil {
+		panic(err)
+	}
+	v, _ := query.Run(nil).Next()
+	err, _ = v.(error)
+	return err
+}()
+
+// isNullIteration returns true if err is gojq's error of iterating over null
+func isNullIteration(err error) bool {
+	if err == nil || nullIteration == nil {
+		return false
+	}
+	return reflect.TypeOf(err) == reflect.TypeOf(nullIteration) && err.Error() == nullIteration.Error()
+}
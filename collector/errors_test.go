@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/utilitywarehouse/json_exporter/jq"
+)
+
+func Test_isNullIteration(t *testing.T) {
+	tests := []struct {
+		name  string
+		exp   string
+		input string
+		want  bool
+	}{
+		{"null", ".values[]", `{}`, true},
+		{"null-nested", ".values[].ids[]", `{"values": [{"ids": null}]}`, true},
+		{"number", ".values[]", `{"values": 1}`, false},
+		{"string", ".[]", `"text"`, false},
+		{"object-index", ".id", `[1]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := (&jq.Compiler{}).Compile(tt.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var iErr error
+			iter := code.Run(mustParseJson(tt.input))
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if e, ok := v.(error); ok {
+					iErr = e
+					break
+				}
+			}
+			if iErr == nil {
+				t.Fatalf("expected error for exp:%s", tt.exp)
+			}
+			if got := isNullIteration(iErr); got != tt.want {
+				t.Errorf("isNullIteration() = %v, want %v err:%v", got, tt.want, iErr)
+			}
+		})
+	}
+
+	if isNullIteration(errors.New("cannot iterate over: null")) {
+		t.Errorf("isNullIteration() = true, want false for error with same message")
+	}
+}
+
+func Test_errorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"value", errors.New("unable to sanitize value"), errClassValue},
+		{"labels", &collectError{class: errClassLabels, err: errors.New("label")}, errClassLabels},
+		{"wrapped", fmt.Errorf("err:%w", &collectError{class: errClassFilter, err: errors.New("filter")}), errClassFilter},
+		{"timeout", &collectError{class: errClassLabels, err: fmt.Errorf("err:%w", context.DeadlineExceeded)}, errClassTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("errorClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
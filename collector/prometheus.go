@@ -2,6 +2,8 @@ package collector
 
 import (
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -12,17 +14,60 @@ var cmu collectorMetricsUpdater
 type collectorMetricsUpdater interface {
 	updateCollectorSuccess(string, bool)
 	updateCollectorDuration(string, float64, bool)
+	updateExpiredSeries(string, int)
+	updateDroppedSamples(string, string)
+	updateOverflowSamples(string, string)
+	updateRejectedMetricNames(string, string, string)
+	updateWorkers(string, int)
+	updateBusyWorkers(string, float64)
+	updateQueueDuration(string, float64)
+	updateQueueDepth(string, int)
+	updateQueueDropped(string, string)
+	updateCollectionErrors(string, string, string)
+	updateDedup(string, bool)
+	updateSnapshot(string, time.Time, bool)
+	registerStateMetrics(*prometheus.Registry)
 }
 
 // collectorMetrics implements instrumentation of metrics for collectors
 // count is a Counter vector to increment the number of successful and failed collection attempts for each collector.
 // duration is a Summary vector that keeps track of the duration for collections per payload.
+// expiredSeries is a Gauge vector of number of series removed by the last expiry sweep of each collector.
+// droppedSamples and overflowSamples are Counter vectors of samples dropped or folded into the overflow
+// series for each metric once its series limit is reached.
+// workers and busyWorkers are Gauge vectors of the total and busy workers of each collector,
+// utilisation of the workers is busy workers over total workers.
+// queueDuration is a Histogram vector of time the inputs waited for a worker since they were sent to the collector.
+// queueDepth is a Gauge vector of number of inputs in the queue of each collector.
+// queueDropped is a Counter vector of inputs dropped or rejected once queue of the collector is full.
+// collectionErrors is a Counter vector of collection errors of each metric by the error class.
+// dedupHits and dedupMisses are Counter vectors of inputs skipped as duplicates and inputs seen for the first time.
+// snapshotAge is the age of the last successfully saved or restored state snapshot.
+// snapshotErrors is a Counter vector of failed state snapshot saves and restores.
+// snapshot metrics are only registered if state persistence is enabled.
 type collectorMetrics struct {
-	count    *prometheus.CounterVec
-	duration *prometheus.HistogramVec
+	count            *prometheus.CounterVec
+	duration         *prometheus.HistogramVec
+	expiredSeries    *prometheus.GaugeVec
+	droppedSamples   *prometheus.CounterVec
+	overflowSamples  *prometheus.CounterVec
+	rejectedNames    *prometheus.CounterVec
+	workers          *prometheus.GaugeVec
+	busyWorkers      *prometheus.GaugeVec
+	queueDuration    *prometheus.HistogramVec
+	queueDepth       *prometheus.GaugeVec
+	queueDropped     *prometheus.CounterVec
+	collectionErrors *prometheus.CounterVec
+	dedupHits        *prometheus.CounterVec
+	dedupMisses      *prometheus.CounterVec
+	snapshotAge      prometheus.GaugeFunc
+	snapshotErrors   *prometheus.CounterVec
+
+	// lastSnapshot is the unix time in nanoseconds of the last successful snapshot
+	lastSnapshot atomic.Int64
 }
 
-func initMetrics(reg *prometheus.Registry, exporterNamespace string) {
+func InitMetrics(reg *prometheus.Registry, exporterNamespace string) {
 	sm := new(collectorMetrics)
 
 	sm.count = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -51,7 +96,178 @@ func initMetrics(reg *prometheus.Registry, exporterNamespace string) {
 		},
 	)
 
-	reg.MustRegister(sm.count, sm.duration)
+	sm.expiredSeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_expired_series",
+		Help:      "Number of series removed by the last expiry sweep",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.droppedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "series_limit_dropped_samples_total",
+		Help:      "Number of samples dropped because series limit of the metric is reached",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+			// Name of the metric
+			"metric",
+		},
+	)
+
+	sm.overflowSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "series_limit_overflow_samples_total",
+		Help:      "Number of samples folded into overflow series because series limit of the metric is reached",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+			// Name of the metric
+			"metric",
+		},
+	)
+
+	sm.rejectedNames = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "rejected_metric_names_total",
+		Help:      "Number of samples dropped because metric name taken from the json is rejected",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+			// Name of the metric config
+			"metric",
+			// Reason: invalid_name, not_allowed or register_failed
+			"reason",
+		},
+	)
+
+	sm.workers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_workers",
+		Help:      "Number of workers of the collector",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.busyWorkers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_busy_workers",
+		Help:      "Number of workers of the collector currently processing an input",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.queueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_queue_duration_seconds",
+		Help:      "Duration an input waited for a worker of the collector",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_queue_depth",
+		Help:      "Number of inputs waiting in the queue of the collector",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.queueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_queue_dropped_total",
+		Help:      "Number of inputs dropped or rejected because queue of the collector is full",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+			// Policy: drop-newest, drop-oldest or reject
+			"policy",
+		},
+	)
+
+	sm.collectionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "collection_errors_total",
+		Help:      "Number of errors of collecting metrics from the json objects",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+			// Name of the metric
+			"metric",
+			// Class: null_iteration, path, filter, name, labels, timestamp, value or timeout
+			"class",
+		},
+	)
+
+	sm.dedupHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_dedup_hits_total",
+		Help:      "Number of inputs skipped because their dedup key was already seen",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.dedupMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "collector_dedup_misses_total",
+		Help:      "Number of inputs processed because their dedup key was not seen",
+	},
+		[]string{
+			// Name of the collector
+			"collector",
+		},
+	)
+
+	sm.snapshotAge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: exporterNamespace,
+		Name:      "state_snapshot_age_seconds",
+		Help:      "Age of the last successfully saved or restored state snapshot, 0 if there is none",
+	}, func() float64 {
+		last := sm.lastSnapshot.Load()
+		if last == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(0, last)).Seconds()
+	})
+
+	sm.snapshotErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: exporterNamespace,
+		Name:      "state_snapshot_errors_total",
+		Help:      "Number of failed state snapshot operations",
+	},
+		[]string{
+			// Operation: save or restore
+			"operation",
+		},
+	)
+
+	reg.MustRegister(sm.count, sm.duration, sm.expiredSeries, sm.droppedSamples, sm.overflowSamples, sm.rejectedNames,
+		sm.workers, sm.busyWorkers, sm.queueDuration, sm.queueDepth, sm.queueDropped, sm.collectionErrors,
+		sm.dedupHits, sm.dedupMisses)
 
 	cmu = sm
 }
@@ -69,3 +285,94 @@ func (sm *collectorMetrics) updateCollectorDuration(collector string, duration f
 		"success":   strconv.FormatBool(success),
 	}).Observe(duration)
 }
+
+func (sm *collectorMetrics) updateExpiredSeries(collector string, count int) {
+	sm.expiredSeries.With(prometheus.Labels{
+		"collector": collector,
+	}).Set(float64(count))
+}
+
+func (sm *collectorMetrics) updateDroppedSamples(collector, metric string) {
+	sm.droppedSamples.With(prometheus.Labels{
+		"collector": collector,
+		"metric":    metric,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateOverflowSamples(collector, metric string) {
+	sm.overflowSamples.With(prometheus.Labels{
+		"collector": collector,
+		"metric":    metric,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateRejectedMetricNames(collector, metric, reason string) {
+	sm.rejectedNames.With(prometheus.Labels{
+		"collector": collector,
+		"metric":    metric,
+		"reason":    reason,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateWorkers(collector string, count int) {
+	sm.workers.With(prometheus.Labels{
+		"collector": collector,
+	}).Set(float64(count))
+}
+
+func (sm *collectorMetrics) updateBusyWorkers(collector string, delta float64) {
+	sm.busyWorkers.With(prometheus.Labels{
+		"collector": collector,
+	}).Add(delta)
+}
+
+func (sm *collectorMetrics) updateQueueDuration(collector string, duration float64) {
+	sm.queueDuration.With(prometheus.Labels{
+		"collector": collector,
+	}).Observe(duration)
+}
+
+func (sm *collectorMetrics) updateQueueDepth(collector string, depth int) {
+	sm.queueDepth.With(prometheus.Labels{
+		"collector": collector,
+	}).Set(float64(depth))
+}
+
+func (sm *collectorMetrics) updateQueueDropped(collector, policy string) {
+	sm.queueDropped.With(prometheus.Labels{
+		"collector": collector,
+		"policy":    policy,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateCollectionErrors(collector, metric, class string) {
+	sm.collectionErrors.With(prometheus.Labels{
+		"collector": collector,
+		"metric":    metric,
+		"class":     class,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateDedup(collector string, hit bool) {
+	counter := sm.dedupMisses
+	if hit {
+		counter = sm.dedupHits
+	}
+	counter.With(prometheus.Labels{
+		"collector": collector,
+	}).Inc()
+}
+
+func (sm *collectorMetrics) updateSnapshot(operation string, snapshotTime time.Time, success bool) {
+	if !success {
+		sm.snapshotErrors.With(prometheus.Labels{
+			"operation": operation,
+		}).Inc()
+		return
+	}
+	sm.lastSnapshot.Store(snapshotTime.UnixNano())
+}
+
+func (sm *collectorMetrics) registerStateMetrics(reg *prometheus.Registry) {
+	reg.MustRegister(sm.snapshotAge, sm.snapshotErrors)
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QueueFullError is returned by Send when input is rejected because the queue
+// of the collector is full and queue policy is reject
+type QueueFullError struct {
+	Collector  string
+	statusCode int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("queue of the collector is full collector:%s", e.Collector)
+}
+
+// StatusCode returns the status code the webhook request should be responded with
+func (e *QueueFullError) StatusCode() int {
+	return e.statusCode
+}
+
+// Accepts returns the error Send would return if n inputs can't be queued
+// without being rejected, it's used to reject a webhook payload before any of
+// its inputs are queued. inputs are always accepted with other policies, and
+// if queue is empty as more inputs than queue size can't be checked.
+func (jc *JSONCollector) Accepts(n int) error {
+	if jc.queuePolicy != QueueReject {
+		return nil
+	}
+	free := cap(jc.Input) - len(jc.Input)
+	if n <= free || free == cap(jc.Input) {
+		return nil
+	}
+	cmu.updateQueueDropped(jc.id, string(QueueReject))
+	return &QueueFullError{Collector: jc.id, statusCode: jc.queueRejectStatusCode}
+}
+
+// Send adds input to the queue of the collector. once the queue is full input
+// is handled as per queue policy, with block policy Send waits until there
+// is space in the queue or context is cancelled.
+func (jc *JSONCollector) Send(ctx context.Context, input any) error {
+	defer func() { cmu.updateQueueDepth(jc.id, len(jc.Input)) }()
+
+	// queue duration includes the time spent waiting in the queue
+	q := queuedInput{input: input, queued: time.Now()}
+
+	select {
+	case jc.Input <- q:
+		return nil
+	default:
+	}
+
+	switch jc.queuePolicy {
+
+	case QueueDropNewest:
+		cmu.updateQueueDropped(jc.id, string(QueueDropNewest))
+		return nil
+
+	case QueueDropOldest:
+		for {
+			select {
+			case <-jc.Input:
+				cmu.updateQueueDropped(jc.id, string(QueueDropOldest))
+			default:
+			}
+
+			select {
+			case jc.Input <- q:
+				return nil
+			default:
+			}
+		}
+
+	case QueueReject:
+		cmu.updateQueueDropped(jc.id, string(QueueReject))
+		return &QueueFullError{Collector: jc.id, statusCode: jc.queueRejectStatusCode}
+
+	default:
+		select {
+		case jc.Input <- q:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("unable to send input collector:%s err:%w", jc.id, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestJSONCollector_Send(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      QueuePolicy
+		wantErrCode int
+		wantQueue   []any
+		wantDropped float64
+	}{
+		{"drop-newest", QueueDropNewest, 0, []any{1, 2}, 1},
+		{"drop-oldest", QueueDropOldest, 0, []any{2, 3}, 1},
+		{"reject", QueueReject, 503, []any{1, 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitMetrics(prometheus.NewRegistry(), "test_exporter")
+			cm := cmu.(*collectorMetrics)
+
+			jc := &JSONCollector{
+				id:                    "queued",
+				Input:                 make(chan queuedInput, 2),
+				queuePolicy:           tt.policy,
+				queueRejectStatusCode: 503,
+			}
+
+			var err error
+			for _, input := range []any{1, 2, 3} {
+				err = jc.Send(context.Background(), input)
+			}
+
+			var qErr *QueueFullError
+			if errors.As(err, &qErr) {
+				if qErr.StatusCode() != tt.wantErrCode {
+					t.Errorf("JSONCollector.Send() status code = %v, want %v", qErr.StatusCode(), tt.wantErrCode)
+				}
+			} else if err != nil || tt.wantErrCode != 0 {
+				t.Errorf("JSONCollector.Send() error = %v, want status code %v", err, tt.wantErrCode)
+			}
+
+			close(jc.Input)
+			var got []any
+			for q := range jc.Input {
+				got = append(got, q.input)
+			}
+			if diff := cmp.Diff(got, tt.wantQueue); diff != "" {
+				t.Errorf("JSONCollector.Send() queue mismatch (-want +got):\n%s", diff)
+			}
+
+			if got := testutil.ToFloat64(cm.queueDropped.WithLabelValues("queued", string(tt.policy))); got != tt.wantDropped {
+				t.Errorf("collector_queue_dropped_total = %v, want %v", got, tt.wantDropped)
+			}
+			if got := testutil.ToFloat64(cm.queueDepth.WithLabelValues("queued")); got != 2 {
+				t.Errorf("collector_queue_depth = %v, want %v", got, 2)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_Accepts(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  QueuePolicy
+		queued  int
+		n       int
+		wantErr bool
+	}{
+		{"fits", QueueReject, 1, 2, false},
+		{"full", QueueReject, 2, 2, true},
+		{"larger-than-free", QueueReject, 2, 3, true},
+		// more inputs than queue size are only checked by Send
+		{"larger-than-queue", QueueReject, 0, 5, false},
+		{"block", QueueBlock, 3, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitMetrics(prometheus.NewRegistry(), "test_exporter")
+
+			jc := &JSONCollector{
+				id:                    "queued",
+				Input:                 make(chan queuedInput, 3),
+				queuePolicy:           tt.policy,
+				queueRejectStatusCode: 429,
+			}
+			for range tt.queued {
+				jc.Input <- queuedInput{}
+			}
+
+			err := jc.Accepts(tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JSONCollector.Accepts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(jc.Input); got != tt.queued {
+				t.Errorf("JSONCollector.Accepts() queue length = %v, want %v", got, tt.queued)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_Send_block(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+
+	jc := &JSONCollector{
+		id:          "queued",
+		Input:       make(chan queuedInput, 1),
+		queuePolicy: QueueBlock,
+	}
+
+	if err := jc.Send(context.Background(), 1); err != nil {
+		t.Fatalf("JSONCollector.Send() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := jc.Send(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("JSONCollector.Send() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// unblocks once there is space in the queue
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-jc.Input
+	}()
+	if err := jc.Send(context.Background(), 3); err != nil {
+		t.Errorf("JSONCollector.Send() error = %v", err)
+	}
+}
+
+func TestJSONCollector_Send_queueDuration(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "queued",
+		Namespace: "test",
+		Metrics:   []*Metric{{Name: "events_total"}},
+	}
+	jc, err := newJSONCollector(c, prometheus.NewPedanticRegistry(), slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+
+	// input waits in the queue until collector is started
+	if err := jc.Send(context.Background(), 1); err != nil {
+		t.Fatalf("JSONCollector.Send() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	go jc.Start(context.Background())
+	jc.Stop()
+
+	var m dto.Metric
+	if err := cm.queueDuration.WithLabelValues("queued").(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("collector_queue_duration_seconds count = %v, want %v", got, 1)
+	}
+	if got := m.GetHistogram().GetSampleSum(); got < 0.05 {
+		t.Errorf("collector_queue_duration_seconds sum = %v, want >= %v", got, 0.05)
+	}
+}
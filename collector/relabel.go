@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RelabelAction is the action of the relabel config, actions follow the
+// semantics of prometheus relabeling
+type RelabelAction string
+
+const (
+	// RelabelReplace sets target label to the replacement if regex matches
+	// the concatenated source labels
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops label sets whose source labels don't match regex
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops label sets whose source labels match regex
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelDrop removes all the labels whose names match regex
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	// RelabelLowercase sets target label to the lowercased source labels
+	RelabelLowercase RelabelAction = "lowercase"
+	// RelabelHashMod sets target label to the modulus of the hash of the
+	// source labels
+	RelabelHashMod RelabelAction = "hashmod"
+	// RelabelLabelMap copies values of the labels whose names match regex to
+	// the labels named by the replacement
+	RelabelLabelMap RelabelAction = "labelmap"
+)
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+// RelabelConfig rewrites or drops the label sets extracted from the json
+// objects before series are updated
+type RelabelConfig struct {
+	// SourceLabels are concatenated with Separator and matched against Regex
+	SourceLabels []string      `yaml:"sourceLabels"`
+	Separator    string        `yaml:"separator"`
+	Regex        string        `yaml:"regex"`
+	Modulus      uint64        `yaml:"modulus"`
+	TargetLabel  string        `yaml:"targetLabel"`
+	Replacement  string        `yaml:"replacement"`
+	Action       RelabelAction `yaml:"action"`
+}
+
+// relabeler is a relabel config with defaults and compiled regex
+type relabeler struct {
+	RelabelConfig
+	regex *regexp.Regexp
+}
+
+// newRelabelers returns relabelers of the configs, regex is anchored at both
+// ends like prometheus relabeling.
+func newRelabelers(configs []RelabelConfig) ([]relabeler, error) {
+	var relabelers []relabeler
+	for i, rc := range configs {
+		if rc.Separator == "" {
+			rc.Separator = defaultRelabelSeparator
+		}
+		if rc.Regex == "" {
+			rc.Regex = defaultRelabelRegex
+		}
+		if rc.Replacement == "" && rc.Action != RelabelLabelDrop {
+			rc.Replacement = defaultRelabelReplacement
+		}
+		if rc.Action == "" {
+			rc.Action = RelabelReplace
+		}
+
+		regex, err := regexp.Compile("^(?:" + rc.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid relabel regex index:%d err:%w", i, err)
+		}
+		relabelers = append(relabelers, relabeler{rc, regex})
+	}
+	return relabelers, nil
+}
+
+// relabel applies all the relabelers to a copy of the label set in order, it
+// returns false if label set is dropped. labels prefixed with '__' can be used
+// as temporary labels, they are removed once all the relabelers are applied.
+func relabel(labels prometheus.Labels, relabelers []relabeler) (prometheus.Labels, bool) {
+	if len(relabelers) == 0 {
+		return labels, true
+	}
+
+	labels = maps.Clone(labels)
+	for _, r := range relabelers {
+		if !r.apply(labels) {
+			return nil, false
+		}
+	}
+
+	for name, value := range labels {
+		if strings.HasPrefix(name, "__") || value == "" {
+			delete(labels, name)
+		}
+	}
+	return labels, true
+}
+
+// apply modifies the label set as per the action, it returns false if label
+// set is dropped. invalid target label names are ignored.
+func (r relabeler) apply(labels prometheus.Labels) bool {
+	values := make([]string, len(r.SourceLabels))
+	for i, name := range r.SourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.Separator)
+
+	switch r.Action {
+
+	case RelabelKeep:
+		return r.regex.MatchString(value)
+
+	case RelabelDrop:
+		return !r.regex.MatchString(value)
+
+	case RelabelReplace:
+		indexes := r.regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.TargetLabel, value, indexes))
+		if !labelNameRegex.MatchString(target) {
+			return true
+		}
+		res := string(r.regex.ExpandString(nil, r.Replacement, value, indexes))
+		if res == "" {
+			delete(labels, target)
+			return true
+		}
+		labels[target] = res
+
+	case RelabelLowercase:
+		labels[r.TargetLabel] = strings.ToLower(value)
+
+	case RelabelHashMod:
+		sum := md5.Sum([]byte(value))
+		labels[r.TargetLabel] = fmt.Sprint(binary.BigEndian.Uint64(sum[8:]) % r.Modulus)
+
+	case RelabelLabelDrop:
+		for name := range labels {
+			if r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+
+	case RelabelLabelMap:
+		mapped := make(prometheus.Labels)
+		for name, v := range labels {
+			if r.regex.MatchString(name) {
+				target := r.regex.ReplaceAllString(name, r.Replacement)
+				if labelNameRegex.MatchString(target) {
+					mapped[target] = v
+				}
+			}
+		}
+		maps.Copy(labels, mapped)
+	}
+	return true
+}
+
+func validateRelabelConfig(rc RelabelConfig) error {
+	if _, err := regexp.Compile(rc.Regex); err != nil {
+		return fmt.Errorf("invalid regex err:%w", err)
+	}
+	for _, name := range rc.SourceLabels {
+		if !labelNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid source label name:%q", name)
+		}
+	}
+
+	switch rc.Action {
+	case "", RelabelReplace:
+		// target label may refer to the capture groups of the regex
+		if rc.TargetLabel == "" {
+			return fmt.Errorf("targetLabel is required for %s action", RelabelReplace)
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(rc.SourceLabels) == 0 {
+			return fmt.Errorf("sourceLabels are required for %s action", rc.Action)
+		}
+	case RelabelLowercase, RelabelHashMod:
+		if len(rc.SourceLabels) == 0 {
+			return fmt.Errorf("sourceLabels are required for %s action", rc.Action)
+		}
+		if !labelNameRegex.MatchString(rc.TargetLabel) {
+			return fmt.Errorf("invalid target label name:%q", rc.TargetLabel)
+		}
+		if rc.Action == RelabelHashMod && rc.Modulus == 0 {
+			return fmt.Errorf("modulus is required for %s action", RelabelHashMod)
+		}
+	case RelabelLabelDrop, RelabelLabelMap:
+		if len(rc.SourceLabels) > 0 || rc.TargetLabel != "" {
+			return fmt.Errorf("sourceLabels and targetLabel are not supported for %s action", rc.Action)
+		}
+	default:
+		return fmt.Errorf("unknown relabel action:%s", rc.Action)
+	}
+
+	if rc.Modulus != 0 && rc.Action != RelabelHashMod {
+		return fmt.Errorf("modulus is only supported for %s action", RelabelHashMod)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_relabel(t *testing.T) {
+	labels := prometheus.Labels{"user": "alice", "app": "HR-Portal", "source_env": "prod", "source_team": "infra"}
+
+	tests := []struct {
+		name     string
+		configs  []RelabelConfig
+		want     prometheus.Labels
+		wantKeep bool
+	}{
+		{"none", nil, labels, true},
+		{"replace-default", []RelabelConfig{{SourceLabels: []string{"app"}, TargetLabel: "application"}},
+			prometheus.Labels{"user": "alice", "app": "HR-Portal", "application": "HR-Portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"replace-regex", []RelabelConfig{{SourceLabels: []string{"app"}, Regex: "(.*)-Portal", TargetLabel: "app", Replacement: "${1}_portal"}},
+			prometheus.Labels{"user": "alice", "app": "HR_portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"replace-separator", []RelabelConfig{{SourceLabels: []string{"source_env", "source_team"}, Separator: "/", TargetLabel: "owner"}},
+			prometheus.Labels{"user": "alice", "app": "HR-Portal", "owner": "prod/infra", "source_env": "prod", "source_team": "infra"}, true},
+		{"replace-no-match", []RelabelConfig{{SourceLabels: []string{"app"}, Regex: "Portal", TargetLabel: "app", Replacement: "x"}}, labels, true},
+		{"replace-empty", []RelabelConfig{{SourceLabels: []string{"app"}, Regex: ".*", TargetLabel: "user", Replacement: "$2"}},
+			prometheus.Labels{"app": "HR-Portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"replace-target-group", []RelabelConfig{{SourceLabels: []string{"user"}, Regex: "(.*)", TargetLabel: "user_$1", Replacement: "true"}},
+			prometheus.Labels{"user": "alice", "user_alice": "true", "app": "HR-Portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"keep", []RelabelConfig{{SourceLabels: []string{"source_env"}, Regex: "prod|staging", Action: RelabelKeep}}, labels, true},
+		{"keep-no-match", []RelabelConfig{{SourceLabels: []string{"source_env"}, Regex: "dev", Action: RelabelKeep}}, nil, false},
+		{"keep-anchored", []RelabelConfig{{SourceLabels: []string{"source_env"}, Regex: "pro", Action: RelabelKeep}}, nil, false},
+		{"drop", []RelabelConfig{{SourceLabels: []string{"user"}, Regex: "alice", Action: RelabelDrop}}, nil, false},
+		{"drop-no-match", []RelabelConfig{{SourceLabels: []string{"user"}, Regex: "bob", Action: RelabelDrop}}, labels, true},
+		{"labeldrop", []RelabelConfig{{Regex: "source_.*", Action: RelabelLabelDrop}},
+			prometheus.Labels{"user": "alice", "app": "HR-Portal"}, true},
+		{"lowercase", []RelabelConfig{{SourceLabels: []string{"app"}, TargetLabel: "app", Action: RelabelLowercase}},
+			prometheus.Labels{"user": "alice", "app": "hr-portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"hashmod", []RelabelConfig{{SourceLabels: []string{"user"}, TargetLabel: "shard", Modulus: 8, Action: RelabelHashMod}},
+			prometheus.Labels{"user": "alice", "shard": "4", "app": "HR-Portal", "source_env": "prod", "source_team": "infra"}, true},
+		{"labelmap", []RelabelConfig{{Regex: "source_(.*)", Action: RelabelLabelMap}},
+			prometheus.Labels{"user": "alice", "app": "HR-Portal", "env": "prod", "team": "infra", "source_env": "prod", "source_team": "infra"}, true},
+		{"temporary-labels", []RelabelConfig{
+			{Regex: "source_(.*)", Replacement: "__tmp_$1", Action: RelabelLabelMap},
+			{Regex: "source_.*", Action: RelabelLabelDrop},
+			{SourceLabels: []string{"__tmp_team"}, TargetLabel: "team"},
+		}, prometheus.Labels{"user": "alice", "app": "HR-Portal", "team": "infra"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relabelers, err := newRelabelers(tt.configs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, keep := relabel(labels, relabelers)
+			if keep != tt.wantKeep {
+				t.Errorf("relabel() keep = %v, want %v", keep, tt.wantKeep)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("relabel() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_validateRelabelConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		rc      RelabelConfig
+		wantErr bool
+	}{
+		{"replace", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b"}, false},
+		{"replace-target-group", RelabelConfig{SourceLabels: []string{"a"}, Regex: "(.*)", TargetLabel: "b_$1"}, false},
+		{"replace-no-target", RelabelConfig{SourceLabels: []string{"a"}}, true},
+		{"invalid-regex", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b", Regex: "("}, true},
+		{"invalid-source", RelabelConfig{SourceLabels: []string{"a-b"}, TargetLabel: "b"}, true},
+		{"keep", RelabelConfig{SourceLabels: []string{"a"}, Regex: "x", Action: RelabelKeep}, false},
+		{"keep-no-source", RelabelConfig{Regex: "x", Action: RelabelKeep}, true},
+		{"drop-no-source", RelabelConfig{Regex: "x", Action: RelabelDrop}, true},
+		{"lowercase-invalid-target", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b_$1", Action: RelabelLowercase}, true},
+		{"hashmod", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b", Modulus: 2, Action: RelabelHashMod}, false},
+		{"hashmod-no-modulus", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b", Action: RelabelHashMod}, true},
+		{"modulus-not-hashmod", RelabelConfig{SourceLabels: []string{"a"}, TargetLabel: "b", Modulus: 2}, true},
+		{"labeldrop", RelabelConfig{Regex: "a.*", Action: RelabelLabelDrop}, false},
+		{"labelmap-target", RelabelConfig{Regex: "a(.*)", TargetLabel: "b", Action: RelabelLabelMap}, true},
+		{"unknown-action", RelabelConfig{Action: "labelkeep"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRelabelConfig(tt.rc); (err != nil) != tt.wantErr {
+				t.Errorf("validateRelabelConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
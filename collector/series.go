@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// series holds the current state of a single label set of a metric
+type series struct {
+	labels      prometheus.Labels
+	labelNames  []string
+	labelValues []string
+	// desc is only set for series with dynamic labels
+	desc *prometheus.Desc
+
+	// value of counter, gauge and info metrics
+	value float64
+	// last cumulative total of the source for counters with set operation
+	total float64
+	// current state of stateset metrics
+	state string
+	// observer of histogram and summary metrics
+	observer prometheus.Observer
+
+	// timestamp of the last sample taken from the payload, zero if not set
+	timestamp time.Time
+	created   time.Time
+	updated   time.Time
+}
+
+// seriesStore keeps all the series of a metric
+type seriesStore struct {
+	mu     sync.Mutex
+	names  []string
+	series map[string]*series
+}
+
+func newSeriesStore(labelNames []string) *seriesStore {
+	return &seriesStore{
+		names:  labelNames,
+		series: make(map[string]*series),
+	}
+}
+
+// labelPairs returns names and values of the label set. store's label names
+// which are set are followed by sorted names of any other labels of the set.
+// store's labels are only missing if they are removed by relabeling.
+func (ss *seriesStore) labelPairs(labels prometheus.Labels) ([]string, []string) {
+	names := ss.names
+	var others []string
+	for n := range labels {
+		if !slices.Contains(ss.names, n) {
+			others = append(others, n)
+		}
+	}
+	if len(others) > 0 || len(labels)-len(others) < len(ss.names) {
+		names = nil
+		for _, n := range ss.names {
+			if _, ok := labels[n]; ok {
+				names = append(names, n)
+			}
+		}
+		slices.Sort(others)
+		names = append(names, others...)
+	}
+
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = labels[n]
+	}
+	return names, values
+}
+
+// key returns unique key of the label set
+func (ss *seriesStore) key(names, values []string) string {
+	// names of store's labels are same for all the series with only store's
+	// labels, names are only part of the key of other series
+	withNames := !slices.Equal(names, ss.names)
+
+	var sb strings.Builder
+	for i := range names {
+		if withNames {
+			sb.WriteString(names[i])
+			sb.WriteByte('=')
+		}
+		sb.WriteString(values[i])
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
+
+// update calls updateFn with the series of the given label set, series is
+// created if its new. it returns false without calling updateFn if label set
+// is new and number of series has reached the limit. limit 0 means no limit.
+func (ss *seriesStore) update(labels prometheus.Labels, now time.Time, limit int, updateFn func(*series)) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	names, values := ss.labelPairs(labels)
+	k := ss.key(names, values)
+	s, ok := ss.series[k]
+	if !ok {
+		if limit > 0 && len(ss.series) >= limit {
+			return false
+		}
+		s = &series{labels: labels, labelNames: names, labelValues: values, created: now}
+		ss.series[k] = s
+	}
+
+	updateFn(s)
+	s.updated = now
+	return true
+}
+
+// expire removes all the series which are not updated since given time
+// and calls deleteFn for each of them.
+func (ss *seriesStore) expire(before time.Time, deleteFn func(*series)) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var count int
+	for k, s := range ss.series {
+		if s.updated.Before(before) {
+			deleteFn(s)
+			delete(ss.series, k)
+			count++
+		}
+	}
+	return count
+}
+
+// each calls fn for all the series of the store
+func (ss *seriesStore) each(fn func(*series)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, s := range ss.series {
+		fn(s)
+	}
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_seriesStore_expire(t *testing.T) {
+	ss := newSeriesStore([]string{"id", "env"})
+	now := time.Now()
+	noop := func(*series) {}
+
+	ss.update(prometheus.Labels{"id": "a", "env": "beta"}, now.Add(-2*time.Minute), 0, noop)
+	ss.update(prometheus.Labels{"id": "b", "env": "beta"}, now.Add(-2*time.Minute), 0, noop)
+	ss.update(prometheus.Labels{"id": "c", "env": "beta"}, now.Add(-2*time.Minute), 0, noop)
+	// update existing series
+	ss.update(prometheus.Labels{"id": "b", "env": "beta"}, now, 0, noop)
+
+	var deleted []prometheus.Labels
+	got := ss.expire(now.Add(-time.Minute), func(s *series) { deleted = append(deleted, s.labels) })
+	if got != 2 {
+		t.Errorf("seriesStore.expire() = %v, want %v", got, 2)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("seriesStore.expire() deleted %v series, want %v", len(deleted), 2)
+	}
+
+	var remaining [][]string
+	ss.each(func(s *series) { remaining = append(remaining, s.labelValues) })
+	if diff := cmp.Diff(remaining, [][]string{{"b", "beta"}}); diff != "" {
+		t.Errorf("seriesStore.expire() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_seriesStore_updateLimit(t *testing.T) {
+	ss := newSeriesStore([]string{"id"})
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		labels prometheus.Labels
+		limit  int
+		want   bool
+		value  float64
+	}{
+		{"new-1", prometheus.Labels{"id": "a"}, 2, true, 1},
+		{"new-2", prometheus.Labels{"id": "b"}, 2, true, 1},
+		{"new-over-limit", prometheus.Labels{"id": "c"}, 2, false, 0},
+		{"existing-at-limit", prometheus.Labels{"id": "a"}, 2, true, 2},
+		{"new-no-limit", prometheus.Labels{"id": "d"}, 0, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value float64
+			got := ss.update(tt.labels, now, tt.limit, func(s *series) {
+				s.value++
+				value = s.value
+			})
+			if got != tt.want {
+				t.Errorf("seriesStore.update() = %v, want %v", got, tt.want)
+			}
+			if value != tt.value {
+				t.Errorf("seriesStore.update() value = %v, want %v", value, tt.value)
+			}
+		})
+	}
+}
+
+func Test_seriesStore_labelPairs(t *testing.T) {
+	ss := newSeriesStore([]string{"id", "env"})
+
+	tests := []struct {
+		name       string
+		labels     prometheus.Labels
+		wantNames  []string
+		wantValues []string
+	}{
+		{"store", prometheus.Labels{"id": "a", "env": "beta"}, []string{"id", "env"}, []string{"a", "beta"}},
+		{"others", prometheus.Labels{"id": "a", "env": "beta", "team": "x", "app": "y"}, []string{"id", "env", "app", "team"}, []string{"a", "beta", "y", "x"}},
+		{"missing", prometheus.Labels{"env": "beta"}, []string{"env"}, []string{"beta"}},
+		{"missing-others", prometheus.Labels{"env": "beta", "team": "x"}, []string{"env", "team"}, []string{"beta", "x"}},
+	}
+	keys := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, values := ss.labelPairs(tt.labels)
+			if diff := cmp.Diff(tt.wantNames, names); diff != "" {
+				t.Errorf("seriesStore.labelPairs() names mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantValues, values); diff != "" {
+				t.Errorf("seriesStore.labelPairs() values mismatch (-want +got):\n%s", diff)
+			}
+			k := ss.key(names, values)
+			if keys[k] {
+				t.Errorf("seriesStore.key() duplicate key:%q", k)
+			}
+			keys[k] = true
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateVersion is the version of the snapshot format, it must be changed
+// if format changes in a way older snapshots can't be restored.
+const stateVersion = 1
+
+// state is the snapshot of all the series of the collectors
+type state struct {
+	Version    int                      `json:"version"`
+	Time       time.Time                `json:"time"`
+	Collectors map[string][]metricState `json:"collectors"`
+}
+
+type metricState struct {
+	Name   string        `json:"name"`
+	Type   MetricType    `json:"type"`
+	Series []seriesState `json:"series"`
+}
+
+type seriesState struct {
+	Labels    map[string]string `json:"labels"`
+	Value     stateValue        `json:"value"`
+	Total     stateValue        `json:"total,omitempty"`
+	State     string            `json:"state,omitempty"`
+	Timestamp time.Time         `json:"timestamp,omitzero"`
+	Created   time.Time         `json:"created"`
+	Updated   time.Time         `json:"updated"`
+}
+
+// stateValue is a float encoded as json number, NaN and ±Inf which are not
+// supported by json are encoded as strings "NaN", "+Inf" and "-Inf".
+type stateValue float64
+
+func (v stateValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (v *stateValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value:%q err:%w", s, err)
+		}
+		*v = stateValue(f)
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*v = stateValue(f)
+	return nil
+}
+
+// StateStore periodically saves the series of the collectors to a file so
+// that they can be restored after restart. histogram and summary metrics are
+// not saved.
+type StateStore struct {
+	path     string
+	interval time.Duration
+	log      *slog.Logger
+
+	mu         sync.Mutex
+	collectors map[string]*JSONCollector
+}
+
+func NewStateStore(path string, interval time.Duration, collectors map[string]*JSONCollector, reg *prometheus.Registry, log *slog.Logger) *StateStore {
+	cmu.registerStateMetrics(reg)
+
+	return &StateStore{
+		path:       path,
+		interval:   interval,
+		collectors: collectors,
+		log:        log.With("state", path),
+	}
+}
+
+// SetCollectors replaces the collectors whose series are saved, used on reload
+func (ss *StateStore) SetCollectors(collectors map[string]*JSONCollector) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.collectors = collectors
+}
+
+// Start saves snapshot every interval until context is cancelled, a final
+// snapshot is saved before returning.
+func (ss *StateStore) Start(ctx context.Context) {
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := ss.Save(); err != nil {
+				ss.log.Error("unable to save state", "err", err)
+			}
+			return
+		case <-ticker.C:
+			if err := ss.Save(); err != nil {
+				ss.log.Error("unable to save state", "err", err)
+			}
+		}
+	}
+}
+
+// Save writes snapshot of all the series to the file. file is replaced
+// atomically so its never left partially written.
+func (ss *StateStore) Save() error {
+	now := time.Now()
+	err := ss.save(now)
+	cmu.updateSnapshot("save", now, err == nil)
+	return err
+}
+
+func (ss *StateStore) save(now time.Time) error {
+	st := state{
+		Version:    stateVersion,
+		Time:       now,
+		Collectors: make(map[string][]metricState),
+	}
+	ss.mu.Lock()
+	for id, jc := range ss.collectors {
+		st.Collectors[id] = jc.snapshot()
+	}
+	ss.mu.Unlock()
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("unable to encode state err:%w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ss.path), filepath.Base(ss.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create state file err:%w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write state file err:%w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync state file err:%w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close state file err:%w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), ss.path); err != nil {
+		return fmt.Errorf("unable to replace state file err:%w", err)
+	}
+	return nil
+}
+
+// Restore loads series of the collectors from the file, its not an error if
+// file doesn't exist. series of metrics which are no longer configured or
+// whose type or labels have changed are ignored.
+func (ss *StateStore) Restore() error {
+	var st state
+	restored, err := ss.restore(&st)
+	if errors.Is(err, fs.ErrNotExist) {
+		ss.log.Info("state file not found, nothing to restore")
+		return nil
+	}
+	cmu.updateSnapshot("restore", st.Time, err == nil)
+	if err != nil {
+		return err
+	}
+	ss.log.Info("state restored", "series", restored, "snapshot", st.Time)
+	return nil
+}
+
+func (ss *StateStore) restore(st *state) (int, error) {
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		return 0, fmt.Errorf("unable to decode state err:%w", err)
+	}
+	if st.Version != stateVersion {
+		return 0, fmt.Errorf("unsupported state version:%d", st.Version)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var count int
+	for id, metrics := range st.Collectors {
+		jc, ok := ss.collectors[id]
+		if !ok {
+			continue
+		}
+		for _, ms := range metrics {
+			n, err := jc.restore(ms)
+			if err != nil {
+				return count, fmt.Errorf("unable to restore metric collector:%s metric:%s err:%w", id, ms.Name, err)
+			}
+			count += n
+		}
+	}
+	return count, nil
+}
+
+// snapshot returns state of all the metrics of the collector
+func (jc *JSONCollector) snapshot() []metricState {
+	var metrics []metricState
+	for _, jm := range jc.metrics {
+		if jm.dynamic == nil {
+			metrics = append(metrics, jm.snapshot()...)
+			continue
+		}
+		for _, dm := range jm.dynamic.all() {
+			metrics = append(metrics, dm.snapshot()...)
+		}
+	}
+	return metrics
+}
+
+// snapshot returns state of the series of the metric
+func (jm *jsonMetric) snapshot() []metricState {
+	if jm.metricType == HistogramMetric || jm.metricType == SummaryMetric {
+		return nil
+	}
+
+	ms := metricState{Name: jm.name, Type: jm.metricType}
+	jm.series.each(func(s *series) {
+		ms.Series = append(ms.Series, seriesState{
+			Labels:    s.labels,
+			Value:     stateValue(s.value),
+			Total:     stateValue(s.total),
+			State:     s.state,
+			Timestamp: s.timestamp,
+			Created:   s.created,
+			Updated:   s.updated,
+		})
+	})
+	return []metricState{ms}
+}
+
+// restore sets series of the metric with the same name and type, it returns
+// number of restored series. series whose label names don't match the config
+// of the metric are ignored and series limit of the metric is applied.
+func (jc *JSONCollector) restore(ms metricState) (int, error) {
+	jm, err := jc.metricByName(ms.Name)
+	if err != nil || jm == nil || jm.metricType != ms.Type {
+		return 0, err
+	}
+
+	var count int
+	for _, st := range ms.Series {
+		if !jm.restorable(st.Labels) {
+			continue
+		}
+		ok := jm.series.update(st.Labels, st.Updated, jm.maxSeries, func(s *series) {
+			s.value = float64(st.Value)
+			s.total = float64(st.Total)
+			s.state = st.State
+			s.timestamp = st.Timestamp
+			s.created = st.Created
+		})
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// restorable returns true if the label names of the saved series can be
+// produced by the current config of the metric. store's labels can only be
+// missing if metric has relabel configs and other labels must be either
+// allowed dynamic labels or produced by relabeling.
+func (jm *jsonMetric) restorable(labels map[string]string) bool {
+	relabeled := len(jm.relabelers) > 0
+
+	for _, n := range jm.series.names {
+		if _, ok := labels[n]; !ok && !relabeled {
+			return false
+		}
+	}
+	for n := range labels {
+		if slices.Contains(jm.series.names, n) {
+			continue
+		}
+		if !labelNameRegex.MatchString(n) || isReservedLabel(jm.metricType, jm.name, n) {
+			return false
+		}
+		dynamic := jm.dynamicLabels != nil && jm.dynamicLabels.allowed(n) && !strings.HasPrefix(n, "__")
+		if !dynamic && !relabeled {
+			return false
+		}
+	}
+	return true
+}
+
+// metricByName returns the metric with the given name including dynamic
+// metrics, nil is returned if there is no such metric.
+func (jc *JSONCollector) metricByName(name string) (*jsonMetric, error) {
+	for _, jm := range jc.metrics {
+		if jm.dynamic == nil && jm.name == name {
+			return jm, nil
+		}
+	}
+	for _, jm := range jc.metrics {
+		if jm.dynamic != nil && jm.dynamic.allowed(name) {
+			return jm.namedMetric(name)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,322 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStateStore_SaveRestore(t *testing.T) {
+	log := slog.Default()
+
+	newCollector := func() *Collector {
+		return &Collector{
+			id:        "state",
+			Namespace: "test",
+			Metrics: []*Metric{
+				{
+					Name: "requests_total", Path: ".[]", Value: ".requests", Operation: OperationSet,
+					Labels: []Label{{Name: "app", Value: ".app"}},
+				},
+				{
+					Name: "population", Path: ".[]", Value: ".population", Type: GaugeMetric,
+					Labels: []Label{{Name: "app", Value: ".app"}},
+				},
+				{
+					Name: "status", Path: ".[]", Value: ".status", Type: StateSetMetric,
+					States: []string{"up", "down"},
+					Labels: []Label{{Name: "app", Value: ".app"}},
+				},
+				{
+					Name: "duration_seconds", Path: ".[]", Value: ".duration", Type: HistogramMetric,
+					Buckets: []float64{1},
+				},
+				{
+					Name: "dynamic", Path: ".[]", NameFrom: `.app + "_events_total"`,
+					AllowedNamesRegex: ".*_events_total",
+				},
+			},
+		}
+	}
+	input := mustParseJson(`[
+		{"app": "a", "requests": 10, "population": 5, "status": "up", "duration": 0.5},
+		{"app": "b", "requests": 20, "population": 6, "status": "down", "duration": 2}
+	]`)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// collect and save
+	reg := prometheus.NewPedanticRegistry()
+	jc, err := newJSONCollector(newCollector(), reg, log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	jc.process(context.Background(), input)
+
+	ss := NewStateStore(path, 0, map[string]*JSONCollector{"state": jc}, prometheus.NewRegistry(), log)
+	if err := ss.Save(); err != nil {
+		t.Fatalf("StateStore.Save() error = %v", err)
+	}
+
+	// restore into new collector
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	restoredReg := prometheus.NewPedanticRegistry()
+	restored, err := newJSONCollector(newCollector(), restoredReg, log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	rs := NewStateStore(path, 0, map[string]*JSONCollector{"state": restored}, prometheus.NewRegistry(), log)
+	if err := rs.Restore(); err != nil {
+		t.Fatalf("StateStore.Restore() error = %v", err)
+	}
+
+	// histograms are not restored
+	expected := `test_a_events_total 1
+test_b_events_total 1
+test_population{app="a"} 5
+test_population{app="b"} 6
+test_requests_total{app="a"} 10
+test_requests_total{app="b"} 20
+test_status{app="a",status="down"} 0
+test_status{app="a",status="up"} 1
+test_status{app="b",status="down"} 1
+test_status{app="b",status="up"} 0`
+
+	gathering, err := restoredReg.Gather()
+	if err != nil {
+		t.Errorf("StateStore.Restore() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("StateStore.Restore() mismatch (-want +got):\n%s", diff)
+	}
+
+	// counter with set operation continues from the restored total
+	restored.process(context.Background(), mustParseJson(`[{"app": "a", "requests": 15}]`))
+	gathering, err = restoredReg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.process() error = %v", err)
+	}
+	if got := metricsToText(gathering, true); !strings.Contains(got, `test_requests_total{app="a"} 15`) {
+		t.Errorf("JSONCollector.process() after restore = %v, want test_requests_total{app=\"a\"} 15", got)
+	}
+
+	if got := testutil.ToFloat64(cm.snapshotAge); got <= 0 {
+		t.Errorf("state_snapshot_age_seconds = %v, want > 0", got)
+	}
+
+	// temp files are not left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state dir has %v files, want %v", len(entries), 1)
+	}
+}
+
+func TestStateStore_SaveRestore_nonFinite(t *testing.T) {
+	log := slog.Default()
+
+	newCollector := func() *Collector {
+		return &Collector{
+			id:        "state",
+			Namespace: "test",
+			Metrics: []*Metric{
+				{
+					Name: "population", Path: ".[]", Value: ".population", Type: GaugeMetric,
+					Labels: []Label{{Name: "app", Value: ".app"}},
+				},
+			},
+		}
+	}
+	// null value is stored as NaN
+	input := mustParseJson(`[{"app": "a", "population": 5}, {"app": "b"}]`)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	jc, err := newJSONCollector(newCollector(), prometheus.NewPedanticRegistry(), log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	jc.process(context.Background(), input)
+
+	ss := NewStateStore(path, 0, map[string]*JSONCollector{"state": jc}, prometheus.NewRegistry(), log)
+	if err := ss.Save(); err != nil {
+		t.Fatalf("StateStore.Save() error = %v", err)
+	}
+
+	restoredReg := prometheus.NewPedanticRegistry()
+	restored, err := newJSONCollector(newCollector(), restoredReg, log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	rs := NewStateStore(path, 0, map[string]*JSONCollector{"state": restored}, prometheus.NewRegistry(), log)
+	if err := rs.Restore(); err != nil {
+		t.Fatalf("StateStore.Restore() error = %v", err)
+	}
+
+	expected := `test_population{app="a"} 5
+test_population{app="b"} NaN`
+
+	gathering, err := restoredReg.Gather()
+	if err != nil {
+		t.Errorf("StateStore.Restore() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("StateStore.Restore() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStateStore_Restore_labels(t *testing.T) {
+	log := slog.Default()
+
+	data := `{"version": 1, "collectors": {"state": [
+		{"name": "requests_total", "type": "counter", "series": [
+			{"labels": {"app": "a", "env": "prod"}, "value": 1},
+			{"labels": {"app": "b", "env": "prod", "team": "x"}, "value": 2},
+			{"labels": {"app": "c", "env": "prod", "region": "eu"}, "value": 3},
+			{"labels": {"app": "d"}, "value": 4},
+			{"labels": {"app": "e", "env": "dev"}, "value": 5},
+			{"labels": {"app": "f", "env": "dev"}, "value": 6}
+		]},
+		{"name": "relabeled_total", "type": "counter", "series": [
+			{"labels": {"app": "a", "shard": "1"}, "value": 1},
+			{"labels": {"app": "b", "env": "prod"}, "value": 2}
+		]}
+	]}}`
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Collector{
+		id:        "state",
+		Namespace: "test",
+		Metrics: []*Metric{
+			{
+				Name: "requests_total", MaxSeries: 3,
+				Labels:        []Label{{Name: "app", Value: ".app"}, {Name: "env", Value: ".env"}},
+				LabelsFrom:    ".tags",
+				AllowedLabels: []string{"team"},
+			},
+			{
+				Name:   "relabeled_total",
+				Labels: []Label{{Name: "app", Value: ".app"}, {Name: "env", Value: ".env"}},
+				RelabelConfigs: []RelabelConfig{
+					{SourceLabels: []string{"app"}, TargetLabel: "shard", Modulus: 2, Action: RelabelHashMod},
+					{Regex: "env", Action: RelabelLabelDrop},
+				},
+			},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	jc, err := newJSONCollector(c, reg, log, nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+	ss := NewStateStore(path, 0, map[string]*JSONCollector{"state": jc}, prometheus.NewRegistry(), log)
+	if err := ss.Restore(); err != nil {
+		t.Fatalf("StateStore.Restore() error = %v", err)
+	}
+
+	// region is not an allowed label and env is missing, series of app f
+	// is over the series limit. store's labels may be removed by relabeling
+	expected := `test_relabeled_total{app="a",shard="1"} 1
+test_relabeled_total{app="b",env="prod"} 2
+test_requests_total{app="a",env="prod"} 1
+test_requests_total{app="e",env="dev"} 5
+test_requests_total{app="b",env="prod",team="x"} 2`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("StateStore.Restore() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("StateStore.Restore() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_stateValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		json  string
+	}{
+		{"number", 1.5, `1.5`},
+		{"zero", 0, `0`},
+		{"nan", math.NaN(), `"NaN"`},
+		{"inf", math.Inf(1), `"+Inf"`},
+		{"negative-inf", math.Inf(-1), `"-Inf"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(stateValue(tt.value))
+			if err != nil {
+				t.Fatalf("stateValue.MarshalJSON() error = %v", err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("stateValue.MarshalJSON() = %s, want %s", data, tt.json)
+			}
+
+			var got stateValue
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("stateValue.UnmarshalJSON() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.value, float64(got), cmpopts.EquateNaNs()); diff != "" {
+				t.Errorf("stateValue.UnmarshalJSON() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStateStore_Restore(t *testing.T) {
+	log := slog.Default()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		data       string
+		wantErr    bool
+		wantErrors float64
+	}{
+		{"missing-file", "", false, 0},
+		{"unsupported-version", `{"version": 99, "collectors": {}}`, true, 1},
+		{"invalid-json", `{"version":`, true, 1},
+		{"unknown-collector", `{"version": 1, "collectors": {"other": [{"name": "m", "type": "counter", "series": [{"value": 1}]}]}}`, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitMetrics(prometheus.NewRegistry(), "test_exporter")
+			cm := cmu.(*collectorMetrics)
+
+			path := filepath.Join(dir, tt.name+".json")
+			if tt.data != "" {
+				if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ss := NewStateStore(path, 0, map[string]*JSONCollector{}, prometheus.NewRegistry(), log)
+			err := ss.Restore()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StateStore.Restore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := testutil.ToFloat64(cm.snapshotErrors.WithLabelValues("restore")); got != tt.wantErrors {
+				t.Errorf("state_snapshot_errors_total = %v, want %v", got, tt.wantErrors)
+			}
+		})
+	}
+}
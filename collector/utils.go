@@ -3,9 +3,10 @@ package collector
 import (
 	"fmt"
 	"math"
+	"math/big"
 	"strconv"
-
-	"github.com/itchyny/gojq"
+	"strings"
+	"time"
 )
 
 func getLabelNames(labels []jsonLabel) []string {
@@ -16,21 +17,19 @@ func getLabelNames(labels []jsonLabel) []string {
 	return names
 }
 
-func parseAndCompileJQExp(exp string) (*gojq.Code, error) {
-	if exp == "" {
-		exp = "."
-	}
-	query, err := gojq.Parse(exp)
-	if err != nil {
-		return nil, fmt.Errorf("jq query parse error %w", err)
-	}
-
-	code, err := gojq.Compile(query)
-	if err != nil {
-		return nil, fmt.Errorf("jq query compile error %w", err)
+// sanitizeLabelName replaces all the characters not allowed in label names
+// with '_' and prefixes the name with '_' if it starts with a digit
+func sanitizeLabelName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name != "" && '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
 	}
-
-	return code, nil
+	return name
 }
 
 func sanitizeValue(v any) (float64, error) {
@@ -79,3 +78,117 @@ func sanitizeValue(v any) (float64, error) {
 		return 0.0, fmt.Errorf("unknown value %v type '%T'", v, v)
 	}
 }
+
+// numericValue returns float value of numeric json value or numeric string
+func numericValue(v any) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("non numeric string value %q", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("non numeric value %v type '%T'", v, v)
+	}
+}
+
+// aggregateValues reduces all the values to a single value as per given aggregation.
+// null values are ignored by all aggregations except 'first' and 'last'. it returns
+// false if there is no value to aggregate for 'min', 'max' and 'avg'.
+func aggregateValues(agg Aggregation, values []any) (float64, bool, error) {
+	switch agg {
+	case AggregateFirst, AggregateLast:
+		var v any
+		if len(values) > 0 {
+			v = values[0]
+			if agg == AggregateLast {
+				v = values[len(values)-1]
+			}
+		}
+		f, err := sanitizeValue(v)
+		return f, err == nil, err
+
+	case AggregateCount:
+		var count int
+		for _, v := range values {
+			if v != nil {
+				count++
+			}
+		}
+		return float64(count), true, nil
+	}
+
+	var result float64
+	var count int
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		f, err := numericValue(v)
+		if err != nil {
+			return 0, false, err
+		}
+
+		switch {
+		case count == 0:
+			result = f
+		case agg == AggregateMin:
+			result = math.Min(result, f)
+		case agg == AggregateMax:
+			result = math.Max(result, f)
+		default:
+			result += f
+		}
+		count++
+	}
+
+	switch agg {
+	case AggregateSum:
+		return result, true, nil
+	case AggregateAvg:
+		if count == 0 {
+			return 0, false, nil
+		}
+		return result / float64(count), true, nil
+	case AggregateMin, AggregateMax:
+		return result, count > 0, nil
+	default:
+		return 0, false, fmt.Errorf("unknown aggregate:%s", agg)
+	}
+}
+
+// parseTimestamp returns time of the epoch seconds or RFC3339 string value.
+// zero time is returned for null value.
+func parseTimestamp(v any) (time.Time, error) {
+	if v == nil {
+		return time.Time{}, nil
+	}
+
+	if str, ok := v.(string); ok {
+		if _, err := strconv.ParseFloat(str, 64); err != nil {
+			t, err := time.Parse(time.RFC3339, str)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("timestamp is neither epoch seconds nor RFC3339 err:%w", err)
+			}
+			return t, nil
+		}
+	}
+
+	f, err := numericValue(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// fraction is rounded to microseconds as float64 can't hold more precision
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3), nil
+}
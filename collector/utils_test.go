@@ -2,6 +2,7 @@ package collector
 
 import (
 	"testing"
+	"time"
 )
 
 func Test_sanitizeValue(t *testing.T) {
@@ -42,3 +43,101 @@ func Test_sanitizeValue(t *testing.T) {
 		})
 	}
 }
+
+func Test_aggregateValues(t *testing.T) {
+	type args struct {
+		agg    Aggregation
+		values []any
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    float64
+		wantOk  bool
+		wantErr bool
+	}{
+		{"first", args{AggregateFirst, []any{1, 2, 3}}, 1, true, false},
+		{"last", args{AggregateLast, []any{1, 2, "3"}}, 3, true, false},
+		{"sum", args{AggregateSum, []any{1, 2.5, "3"}}, 6.5, true, false},
+		{"sum-with-null", args{AggregateSum, []any{1, nil, 2}}, 3, true, false},
+		{"sum-empty", args{AggregateSum, nil}, 0, true, false},
+		{"count", args{AggregateCount, []any{"a", map[string]any{}, nil, 1}}, 3, true, false},
+		{"count-empty", args{AggregateCount, nil}, 0, true, false},
+		{"min", args{AggregateMin, []any{3, -1, 2}}, -1, true, false},
+		{"max", args{AggregateMax, []any{3, -1, nil, 2}}, 3, true, false},
+		{"max-empty", args{AggregateMax, []any{nil}}, 0, false, false},
+		{"avg", args{AggregateAvg, []any{1, 2, 6}}, 3, true, false},
+		{"avg-empty", args{AggregateAvg, nil}, 0, false, false},
+		{"sum-non-numeric", args{AggregateSum, []any{1, "blah"}}, 0, false, true},
+		{"max-bool", args{AggregateMax, []any{true}}, 0, false, true},
+		{"min-object", args{AggregateMin, []any{map[string]any{}}}, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := aggregateValues(tt.args.agg, tt.args.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("aggregateValues() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if ok != tt.wantOk {
+				t.Errorf("aggregateValues() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("aggregateValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       any
+		want    time.Time
+		wantErr bool
+	}{
+		{"null", nil, time.Time{}, false},
+		{"epoch-int", 1702980137, time.Unix(1702980137, 0), false},
+		{"epoch-float", 1702980137.5, time.Unix(1702980137, 500000000), false},
+		{"epoch-text", "1702980137", time.Unix(1702980137, 0), false},
+		{"rfc3339", "2023-12-19T10:02:17Z", time.Unix(1702980137, 0), false},
+		{"rfc3339-fraction", "2023-12-19T10:02:17.972Z", time.Unix(1702980137, 972000000), false},
+		{"rfc3339-offset", "2023-12-19T11:02:17+01:00", time.Unix(1702980137, 0), false},
+		{"invalid-text", "yesterday", time.Time{}, true},
+		{"bool", true, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimestamp(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTimestamp() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimestamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"team", "team"},
+		{"Team_Name1", "Team_Name1"},
+		{"team-name", "team_name"},
+		{"k8s.io/app", "k8s_io_app"},
+		{"1st", "_1st"},
+		{"__meta", "__meta"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeLabelName(tt.name); got != tt.want {
+				t.Errorf("sanitizeLabelName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
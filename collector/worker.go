@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// queuedInput is an input payload waiting for a worker, queued is the time
+// input was sent to the collector
+type queuedInput struct {
+	input  any
+	queued time.Time
+}
+
+// startWorkers starts the workers of the collector and returns their queues.
+// with perKey ordering each worker has its own buffered queue so that inputs
+// with the same key are always processed by the same worker and a busy worker
+// only delays inputs of its own keys, otherwise all the workers share a single
+// queue. workers return once wCtx is cancelled or their queue is closed.
+func (jc *JSONCollector) startWorkers(ctx, wCtx context.Context, wg *sync.WaitGroup) []chan queuedInput {
+	queues := []chan queuedInput{make(chan queuedInput)}
+	if jc.ordering == OrderingPerKey {
+		queues = nil
+		for range jc.workers {
+			queues = append(queues, make(chan queuedInput, cap(jc.Input)))
+		}
+	}
+
+	for i := range jc.workers {
+		wg.Add(1)
+		go func(queue <-chan queuedInput) {
+			defer wg.Done()
+			jc.work(ctx, wCtx, queue)
+		}(queues[i%len(queues)])
+	}
+
+	cmu.updateWorkers(jc.id, jc.workers)
+
+	return queues
+}
+
+// dispatch sends the input to the queue of the worker, it blocks until a
+// worker or space in the worker's queue is available or context is cancelled.
+func (jc *JSONCollector) dispatch(ctx context.Context, queues []chan queuedInput, q queuedInput) {
+	queue := queues[0]
+	if len(queues) > 1 {
+		queue = queues[jc.queueIndex(ctx, q.input, len(queues))]
+	}
+
+	select {
+	case queue <- q:
+	case <-ctx.Done():
+	}
+}
+
+// queueIndex returns index of the queue for the ordering key of the input.
+// inputs without key or with key errors are sent to the first queue.
+func (jc *JSONCollector) queueIndex(ctx context.Context, input any, count int) int {
+	key, err := extractFirstValue(ctx, jc.orderingKey, input)
+	if err != nil {
+		jc.log.Warn("unable to get ordering key", "err", err)
+		return 0
+	}
+	if key == nil {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(fmt.Sprint(key)))
+	return int(h.Sum32() % uint32(count))
+}
+
+// work processes inputs of the queue until wCtx is cancelled or queue is closed
+func (jc *JSONCollector) work(ctx, wCtx context.Context, queue <-chan queuedInput) {
+	for {
+		select {
+		case <-wCtx.Done():
+			return
+
+		case q, ok := <-queue:
+			if !ok {
+				return
+			}
+			cmu.updateQueueDuration(jc.id, time.Since(q.queued).Seconds())
+			cmu.updateBusyWorkers(jc.id, 1)
+			jc.run(ctx, q.input)
+			cmu.updateBusyWorkers(jc.id, -1)
+		}
+	}
+}
+
+// run processes single input payload and records the result
+func (jc *JSONCollector) run(ctx context.Context, input any) {
+	// create new context for worker
+	wCtx, wCancel := context.WithTimeout(ctx, jc.timeout)
+	defer wCancel()
+
+	key, duplicate := jc.isDuplicate(wCtx, input)
+	if duplicate {
+		jc.log.Debug("duplicate input skipped")
+		return
+	}
+
+	start := time.Now()
+
+	success := jc.process(wCtx, input)
+
+	// input is not fully processed so its retry must not be skipped
+	if !success && key != "" {
+		jc.dedup.Forget(key)
+	}
+
+	cmu.updateCollectorSuccess(jc.id, success)
+	cmu.updateCollectorDuration(jc.id, time.Since(start).Seconds(), success)
+
+	if success {
+		jc.log.Debug("metrics collection completed successfully")
+	} else {
+		jc.log.Error("metrics collection completed with error")
+	}
+}
+
+// Process collects metrics from the input without starting the collector,
+// it's used to evaluate payloads offline. it returns false if there was any
+// error, errors are logged to collector's logger.
+func (jc *JSONCollector) Process(ctx context.Context, input any) bool {
+	jc.activate()
+
+	ctx, cancel := context.WithTimeout(ctx, jc.timeout)
+	defer cancel()
+
+	return jc.process(ctx, input)
+}
+
+// isDuplicate returns true if input was already seen by the collector,
+// otherwise dedup key of the input is recorded and returned. inputs are
+// processed if dedup key can't be extracted.
+func (jc *JSONCollector) isDuplicate(ctx context.Context, input any) (string, bool) {
+	if jc.dedup == nil {
+		return "", false
+	}
+
+	key, ok, err := jc.dedup.Key(ctx, input)
+	if err != nil {
+		jc.log.Warn("unable to deduplicate input", "err", err)
+		return "", false
+	}
+	if !ok {
+		return "", false
+	}
+
+	seen := jc.dedup.SeenKey(key)
+	cmu.updateDedup(jc.id, seen)
+	if seen {
+		return "", true
+	}
+	return key, false
+}
@@ -0,0 +1,298 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/utilitywarehouse/json_exporter/dedup"
+	"github.com/utilitywarehouse/json_exporter/jq"
+)
+
+func TestJSONCollector_queueIndex(t *testing.T) {
+	code, err := (&jq.Compiler{}).Compile(".id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jc := &JSONCollector{log: slog.Default(), orderingKey: code}
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		first := jc.queueIndex(ctx, map[string]any{"id": id, "value": 1}, 4)
+		if first < 0 || first >= 4 {
+			t.Errorf("JSONCollector.queueIndex() = %v, want index within 4 queues", first)
+		}
+		if got := jc.queueIndex(ctx, map[string]any{"id": id, "value": 2}, 4); got != first {
+			t.Errorf("JSONCollector.queueIndex() = %v, want same queue %v for key %s", got, first, id)
+		}
+	}
+
+	if got := jc.queueIndex(ctx, map[string]any{"value": 1}, 4); got != 0 {
+		t.Errorf("JSONCollector.queueIndex() = %v, want %v for missing key", got, 0)
+	}
+	if got := jc.queueIndex(ctx, []any{1}, 4); got != 0 {
+		t.Errorf("JSONCollector.queueIndex() = %v, want %v for key error", got, 0)
+	}
+}
+
+func TestJSONCollector_dispatch_perKey(t *testing.T) {
+	code, err := (&jq.Compiler{}).Compile(".id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jc := &JSONCollector{
+		log:         slog.Default(),
+		Input:       make(chan queuedInput, 3),
+		workers:     2,
+		ordering:    OrderingPerKey,
+		orderingKey: code,
+	}
+
+	// workers are stopped so inputs stay in their queues as if workers are busy
+	wCtx, stopWorkers := context.WithCancel(context.Background())
+	stopWorkers()
+	wg := &sync.WaitGroup{}
+	queues := jc.startWorkers(context.Background(), wCtx, wg)
+	wg.Wait()
+
+	// find keys of both the queues
+	keys := make(map[int]string)
+	for i := 0; len(keys) < 2; i++ {
+		id := fmt.Sprintf("id-%d", i)
+		keys[jc.queueIndex(context.Background(), map[string]any{"id": id}, 2)] = id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// busy worker doesn't delay inputs of the other keys
+	for range 3 {
+		jc.dispatch(ctx, queues, queuedInput{input: map[string]any{"id": keys[0]}})
+	}
+	jc.dispatch(ctx, queues, queuedInput{input: map[string]any{"id": keys[1]}})
+
+	if got := len(queues[0]); got != 3 {
+		t.Errorf("JSONCollector.dispatch() queue length = %v, want %v", got, 3)
+	}
+	if got := len(queues[1]); got != 1 {
+		t.Errorf("JSONCollector.dispatch() queue length = %v, want %v", got, 1)
+	}
+}
+
+func TestJSONCollector_Start_ordering(t *testing.T) {
+	tests := []struct {
+		name        string
+		ordering    Ordering
+		orderingKey string
+		wantWorkers float64
+	}{
+		{"strict", OrderingStrict, "", 1},
+		{"per-key", OrderingPerKey, ".id", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			InitMetrics(prometheus.NewRegistry(), "test_exporter")
+			cm := cmu.(*collectorMetrics)
+
+			c := &Collector{
+				id:          "ordered",
+				Namespace:   "test",
+				Workers:     int(tt.wantWorkers),
+				Ordering:    tt.ordering,
+				OrderingKey: tt.orderingKey,
+				Metrics: []*Metric{
+					{
+						Name: "value", Type: GaugeMetric, Value: ".value",
+						Labels: []Label{{Name: "id", Value: ".id"}},
+					},
+				},
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+			if err != nil {
+				t.Fatalf("newJSONCollector() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				collector.Start(ctx)
+				close(done)
+			}()
+
+			count := 100
+			for i := 1; i <= count; i++ {
+				for _, id := range []string{"a", "b", "c"} {
+					if err := collector.Send(ctx, mustParseJson(fmt.Sprintf(`{"id": "%s", "value": %d}`, id, i))); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// wait for all the inputs to be processed
+			deadline := time.Now().Add(5 * time.Second)
+			for testutil.ToFloat64(cm.count.WithLabelValues("ordered", "true")) < float64(count*3) {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out waiting for inputs to be processed")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			cancel()
+			<-done
+
+			expected := `test_value{id="a"} 100
+test_value{id="b"} 100
+test_value{id="c"} 100`
+
+			gathering, err := reg.Gather()
+			if err != nil {
+				t.Errorf("JSONCollector.Start() error = %v", err)
+			}
+			if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+				t.Errorf("JSONCollector.Start() mismatch (-want +got):\n%s", diff)
+			}
+
+			if got := testutil.ToFloat64(cm.workers.WithLabelValues("ordered")); got != tt.wantWorkers {
+				t.Errorf("collector_workers = %v, want %v", got, tt.wantWorkers)
+			}
+			if got := testutil.ToFloat64(cm.busyWorkers.WithLabelValues("ordered")); got != 0 {
+				t.Errorf("collector_busy_workers = %v, want %v", got, 0)
+			}
+		})
+	}
+}
+
+func TestJSONCollector_run_dedup(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+	cm := cmu.(*collectorMetrics)
+
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Dedup:     &dedup.Config{Key: ".uuid", TTL: time.Hour},
+		Metrics: []*Metric{
+			{Name: "events_total", Labels: []Label{{Name: "type", Value: ".type"}}},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+
+	for _, input := range []string{
+		`{"uuid": "1", "type": "login"}`,
+		// retried deliveries
+		`{"uuid": "1", "type": "login"}`,
+		`{"uuid": "1", "type": "login"}`,
+		`{"uuid": "2", "type": "login"}`,
+		// events without key are not deduplicated
+		`{"type": "logout"}`,
+		`{"type": "logout"}`,
+	} {
+		collector.run(context.Background(), mustParseJson(input))
+	}
+
+	expected := `test_events_total{type="login"} 2
+test_events_total{type="logout"} 2`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.run() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.run() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := testutil.ToFloat64(cm.dedupHits.WithLabelValues("events")); got != 2 {
+		t.Errorf("collector_dedup_hits_total = %v, want %v", got, 2)
+	}
+	if got := testutil.ToFloat64(cm.dedupMisses.WithLabelValues("events")); got != 2 {
+		t.Errorf("collector_dedup_misses_total = %v, want %v", got, 2)
+	}
+}
+
+func TestJSONCollector_run_dedupFailed(t *testing.T) {
+	InitMetrics(prometheus.NewRegistry(), "test_exporter")
+
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Dedup:     &dedup.Config{Key: ".uuid", TTL: time.Hour},
+		Metrics: []*Metric{
+			{Name: "events_size", Type: GaugeMetric, Value: ".size"},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+
+	for _, input := range []string{
+		// key of the failed input is forgotten so that its retry is processed
+		`{"uuid": "1", "size": "invalid"}`,
+		`{"uuid": "1", "size": 10}`,
+		// retry of the processed input is skipped
+		`{"uuid": "1", "size": 20}`,
+	} {
+		collector.run(context.Background(), mustParseJson(input))
+	}
+
+	expected := `test_events_size 10`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.run() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.run() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONCollector_Process(t *testing.T) {
+	c := &Collector{
+		id:        "events",
+		Namespace: "test",
+		Dedup:     &dedup.Config{Key: ".uuid", TTL: time.Hour},
+		Metrics: []*Metric{
+			{Name: "events_total", Labels: []Label{{Name: "type", Value: ".type"}}},
+			{Name: "dynamic", NameFrom: `.type + "_total"`, AllowedNamesRegex: ".*_total"},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	collector, err := newJSONCollector(c, reg, slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("newJSONCollector() error = %v", err)
+	}
+
+	// inputs are not deduplicated and dynamic metrics are registered without
+	// starting the collector
+	for range 2 {
+		if !collector.Process(context.Background(), mustParseJson(`{"uuid": "1", "type": "login"}`)) {
+			t.Errorf("JSONCollector.Process() = false, want true")
+		}
+	}
+
+	expected := `test_events_total{type="login"} 2
+test_login_total 2`
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		t.Errorf("JSONCollector.Process() error = %v", err)
+	}
+	if diff := cmp.Diff(metricsToText(gathering, true), expected); diff != "" {
+		t.Errorf("JSONCollector.Process() mismatch (-want +got):\n%s", diff)
+	}
+}
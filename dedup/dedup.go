@@ -0,0 +1,171 @@
+// Package dedup skips json objects already seen within a time window using
+// the idempotency key of the object.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/utilitywarehouse/json_exporter/jq"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultTTL     = time.Hour
+	defaultMaxSize = 10000
+)
+
+// Config is the dedup config of a collector or a webhook
+type Config struct {
+	// Key is the jq expression of the idempotency key of the object
+	Key string `yaml:"key"`
+	// TTL is the duration for which a key is remembered, default is 1h
+	TTL time.Duration `yaml:"ttl"`
+	// MaxSize is the max number of keys remembered, once reached oldest keys
+	// are forgotten. default is 10000
+	MaxSize int `yaml:"maxSize"`
+}
+
+// Validate returns error if config is invalid
+func (c Config) Validate() error {
+	if c.Key == "" {
+		return fmt.Errorf("dedup key is required")
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("dedup ttl must not be negative")
+	}
+	if c.MaxSize < 0 {
+		return fmt.Errorf("dedup maxSize must not be negative")
+	}
+	return nil
+}
+
+// Fingerprint returns the config along with the jq config and variables the
+// key expression is compiled with, deduplicators with the same fingerprint
+// extract the same keys so their state can be reused on reload.
+func Fingerprint(config Config, jqc *jq.Compiler) string {
+	data, err := yaml.Marshal(struct {
+		Config    Config
+		JQ        jq.Config
+		Variables map[string]any
+	}{config, jqc.Config(), jqc.Variables()})
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Deduplicator keeps the keys of the objects seen within ttl, its safe for
+// concurrent use.
+type Deduplicator struct {
+	key     *jq.Code
+	ttl     time.Duration
+	maxSize int
+
+	mu sync.Mutex
+	// keys and order hold the same entries, order is oldest first
+	keys  map[string]*list.Element
+	order *list.List
+
+	now func() time.Time
+}
+
+type entry struct {
+	key  string
+	seen time.Time
+}
+
+// New returns Deduplicator of the config, key is the compiled Key expression
+func New(config Config, key *jq.Code) *Deduplicator {
+	d := &Deduplicator{
+		key:     key,
+		ttl:     config.TTL,
+		maxSize: config.MaxSize,
+		keys:    make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+	if d.ttl == 0 {
+		d.ttl = defaultTTL
+	}
+	if d.maxSize == 0 {
+		d.maxSize = defaultMaxSize
+	}
+	return d
+}
+
+// Seen returns true if the key of the object was seen within ttl, otherwise
+// the key is recorded. ok is false if object has no key, such objects
+// should not be skipped.
+func (d *Deduplicator) Seen(ctx context.Context, object any) (seen, ok bool, err error) {
+	key, ok, err := d.Key(ctx, object)
+	if !ok || err != nil {
+		return false, false, err
+	}
+	return d.SeenKey(key), true, nil
+}
+
+// Key returns the idempotency key of the object, ok is false if object has
+// no key.
+func (d *Deduplicator) Key(ctx context.Context, object any) (key string, ok bool, err error) {
+	iter := d.key.RunWithContext(ctx, object)
+	v, found := iter.Next()
+	if !found || v == nil {
+		return "", false, nil
+	}
+	if err, ok := v.(error); ok {
+		return "", false, fmt.Errorf("unable to get dedup key err:%w", err)
+	}
+	return fmt.Sprint(v), true, nil
+}
+
+// SeenKey returns true if the key was seen within ttl, otherwise the key is
+// recorded. key is checked and recorded in a single step so concurrent
+// callers with the same key can't both miss.
+func (d *Deduplicator) SeenKey(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expire(now)
+
+	if _, ok := d.keys[key]; ok {
+		return true
+	}
+
+	d.keys[key] = d.order.PushBack(&entry{key: key, seen: now})
+
+	for d.order.Len() > d.maxSize {
+		d.remove(d.order.Front())
+	}
+	return false
+}
+
+// Forget removes the recorded key so that the object is not skipped when its
+// received again, i.e. when processing of the object has failed.
+func (d *Deduplicator) Forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.keys[key]; ok {
+		d.remove(e)
+	}
+}
+
+// expire removes all the keys not seen within ttl
+func (d *Deduplicator) expire(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		if now.Sub(e.Value.(*entry).seen) < d.ttl {
+			return
+		}
+		d.remove(e)
+	}
+}
+
+func (d *Deduplicator) remove(e *list.Element) {
+	d.order.Remove(e)
+	delete(d.keys, e.Value.(*entry).key)
+}
@@ -0,0 +1,136 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/utilitywarehouse/json_exporter/jq"
+)
+
+func mustCompile(t *testing.T, exp string) *jq.Code {
+	t.Helper()
+	code, err := (&jq.Compiler{}).Compile(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestDeduplicator_Seen(t *testing.T) {
+	d := New(Config{Key: ".uuid", TTL: time.Minute, MaxSize: 2}, mustCompile(t, ".uuid"))
+
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		object   any
+		advance  time.Duration
+		wantSeen bool
+		wantOk   bool
+	}{
+		{"new-a", map[string]any{"uuid": "a"}, 0, false, true},
+		{"retry-a", map[string]any{"uuid": "a"}, 10 * time.Second, true, true},
+		{"no-key", map[string]any{"id": "a"}, 0, false, false},
+		{"new-b", map[string]any{"uuid": "b"}, 0, false, true},
+		{"new-c-evicts-a", map[string]any{"uuid": "c"}, 0, false, true},
+		{"a-after-eviction", map[string]any{"uuid": "a"}, 0, false, true},
+		{"c-within-ttl", map[string]any{"uuid": "c"}, 40 * time.Second, true, true},
+		{"c-after-ttl", map[string]any{"uuid": "c"}, 30 * time.Second, false, true},
+		{"numeric-key", map[string]any{"uuid": 1}, 0, false, true},
+		{"numeric-key-retry", map[string]any{"uuid": 1}, 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			seen, ok, err := d.Seen(context.Background(), tt.object)
+			if err != nil {
+				t.Fatalf("Deduplicator.Seen() error = %v", err)
+			}
+			if seen != tt.wantSeen {
+				t.Errorf("Deduplicator.Seen() seen = %v, want %v", seen, tt.wantSeen)
+			}
+			if ok != tt.wantOk {
+				t.Errorf("Deduplicator.Seen() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if d.order.Len() > 2 {
+				t.Errorf("Deduplicator keys = %v, want at most %v", d.order.Len(), 2)
+			}
+		})
+	}
+}
+
+func TestDeduplicator_Seen_error(t *testing.T) {
+	d := New(Config{Key: ".uuid"}, mustCompile(t, ".uuid"))
+
+	if _, _, err := d.Seen(context.Background(), []any{1}); err == nil {
+		t.Errorf("Deduplicator.Seen() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestDeduplicator_Seen_concurrent(t *testing.T) {
+	d := New(Config{Key: ".uuid"}, mustCompile(t, ".uuid"))
+
+	var misses atomic.Int32
+	wg := &sync.WaitGroup{}
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen, _, err := d.Seen(context.Background(), map[string]any{"uuid": "a"})
+			if err != nil {
+				t.Error(err)
+			}
+			if !seen {
+				misses.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := misses.Load(); got != 1 {
+		t.Errorf("Deduplicator.Seen() misses = %v, want %v", got, 1)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"valid", Config{Key: ".uuid", TTL: time.Hour, MaxSize: 100}, false},
+		{"defaults", Config{Key: ".uuid"}, false},
+		{"no-key", Config{TTL: time.Hour}, true},
+		{"negative-ttl", Config{Key: ".uuid", TTL: -time.Hour}, true},
+		{"negative-size", Config{Key: ".uuid", MaxSize: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeduplicator_Forget(t *testing.T) {
+	d := New(Config{Key: ".uuid"}, mustCompile(t, ".uuid"))
+
+	if d.SeenKey("a") {
+		t.Errorf("Deduplicator.SeenKey() = %v, want %v", true, false)
+	}
+	d.Forget("a")
+	// unknown keys are ignored
+	d.Forget("b")
+
+	if d.SeenKey("a") {
+		t.Errorf("Deduplicator.SeenKey() after Forget() = %v, want %v", true, false)
+	}
+	if !d.SeenKey("a") {
+		t.Errorf("Deduplicator.SeenKey() = %v, want %v", false, true)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/webhook"
+)
+
+// syncInput processes the payloads sent by the webhooks synchronously
+type syncInput struct {
+	collector *collector.JSONCollector
+}
+
+func (i syncInput) Send(ctx context.Context, input any) error {
+	i.collector.Process(ctx, input)
+	return nil
+}
+
+// commentWriter writes every line as a comment of the text exposition format
+// so that errors are shown inline with the metrics
+type commentWriter struct {
+	w     io.Writer
+	lines int
+}
+
+func (cw *commentWriter) Write(p []byte) (int, error) {
+	for line := range bytes.Lines(p) {
+		cw.lines++
+		if _, err := fmt.Fprintf(cw.w, "# %s", line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// commandLogger returns logger of the offline commands, only warnings and
+// errors are logged as info logs are not useful for a single run
+func commandLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// evalPayloads runs the payloads of the files through the config and prints
+// the metrics to stdout, it returns the exit code of the eval command.
+func evalPayloads(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := fs.String("config", "json-exporter.yaml", "exporter config file path")
+	webhookID := fs.String("webhook", "", "id of the webhook to run payloads through")
+	collectorID := fs.String("collector", "", "id of the collector to process payloads with, webhook transforms are skipped")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: json_exporter eval --config <file> (--webhook <id> | --collector <id>) [payload.json...]\n")
+		fmt.Fprintf(stderr, "payloads are read from stdin if no files are given\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*webhookID == "") == (*collectorID == "") {
+		fs.Usage()
+		return 2
+	}
+
+	// errors are shown inline
+	errs := &commentWriter{w: stdout}
+	log := commandLogger(errs)
+
+	// exporter's own metrics are not printed
+	collector.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+	webhook.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+
+	// metrics are registered to an isolated registry
+	reg := prometheus.NewRegistry()
+	collectors, err := collector.Load(*config, reg, log, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	collectorInputs := make(map[string]webhook.Input)
+	for id, c := range collectors {
+		collectorInputs[id] = syncInput{c}
+	}
+
+	var process func(ctx context.Context, payload any) error
+	switch {
+	case *webhookID != "":
+		webhooks, err := webhook.Load(*config, log, collectorInputs, nil)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return 1
+		}
+		wh, ok := webhooks[*webhookID]
+		if !ok {
+			fmt.Fprintf(stderr, "unknown webhook id:%s\n", *webhookID)
+			return 1
+		}
+		process = wh.Process
+	default:
+		input, ok := collectorInputs[*collectorID]
+		if !ok {
+			fmt.Fprintf(stderr, "unknown collector id:%s\n", *collectorID)
+			return 1
+		}
+		process = input.Send
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	ctx := context.Background()
+	for _, file := range files {
+		fmt.Fprintf(stdout, "# payload: %s\n", file)
+		if err := evalFile(ctx, file, process); err != nil {
+			fmt.Fprintf(stderr, "unable to eval payload file:%s err:%s\n", file, err)
+			return 1
+		}
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		fmt.Fprintf(errs, "unable to gather metrics err:%s\n", err)
+	}
+	enc := expfmt.NewEncoder(stdout, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range gathering {
+		if err := enc.Encode(mf); err != nil {
+			fmt.Fprintf(stderr, "unable to encode metrics err:%s\n", err)
+			return 1
+		}
+	}
+
+	if errs.lines > 0 {
+		return 1
+	}
+	return 0
+}
+
+// evalFile processes all the json payloads of the file, "-" is stdin
+func evalFile(ctx context.Context, file string, process func(ctx context.Context, payload any) error) error {
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var payload any
+		if err := dec.Decode(&payload); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := process(ctx, payload); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_evalPayloads(t *testing.T) {
+	dir := t.TempDir()
+	config := `
+webhooks:
+  animals:
+    method: POST
+    path: /animals
+    collectors:
+      - id: animals
+        transform: .animals[]
+collectors:
+  animals:
+    namespace: test
+    metrics:
+      - name: animal_population
+        type: gauge
+        value: .population + 0
+        labels:
+          - name: name
+            value: .noun
+`
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	writePayload := func(name, payload string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(payload), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// a file may contain multiple payloads
+	valid := writePayload("valid.json", `{"animals": [{"noun": "lion", "population": 123}]}
+{"animals": [{"noun": "deer", "population": 456}]}`)
+	invalid := writePayload("invalid.json", `{"animals": [{"noun": "lion", "population": "many"}]}`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantCode int
+	}{
+		{
+			"webhook",
+			[]string{"--config", configPath, "--webhook", "animals", valid},
+			`# payload: ` + valid + `
+# HELP test_animal_population json_exporter metric:animal_population
+# TYPE test_animal_population gauge
+test_animal_population{name="deer"} 456
+test_animal_population{name="lion"} 123
+`,
+			0,
+		},
+		{
+			"collector",
+			[]string{"--config", configPath, "--collector", "animals", writePayload("animal.json", `{"noun": "lion", "population": 123}`)},
+			`# payload: ` + filepath.Join(dir, "animal.json") + `
+# HELP test_animal_population json_exporter metric:animal_population
+# TYPE test_animal_population gauge
+test_animal_population{name="lion"} 123
+`,
+			0,
+		},
+		{
+			// errors are printed inline as comments
+			"inline-error",
+			[]string{"--config", configPath, "--webhook", "animals", invalid},
+			`# payload: ` + invalid + `
+# level=ERROR msg="unable to collect" collector=animals metric=animal_population class=value err="unable to get value err:unable to get value err:cannot add: string (\"many\") and number (0)"
+`,
+			1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := evalPayloads(tt.args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("evalPayloads() code = %v, want %v stderr:%s", code, tt.wantCode, stderr.String())
+			}
+			if diff := cmp.Diff(tt.want, stdout.String()); diff != "" {
+				t.Errorf("evalPayloads() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_evalPayloads_usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"--webhook", "a", "--collector", "b"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := evalPayloads(args, &stdout, &stderr); code != 2 {
+			t.Errorf("evalPayloads() args:%v code = %v, want %v", args, code, 2)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package jq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// Config is the top-level jq config shared by all the expressions of
+// collectors and webhooks
+type Config struct {
+	// Definitions are jq function definitions prepended to every expression
+	Definitions string `yaml:"definitions"`
+	// LibraryPaths are the directories of the jq modules which can be
+	// imported by the expressions, relative paths are relative to the config
+	LibraryPaths []string `yaml:"libraryPaths"`
+}
+
+// Compiler compiles jq expressions with the definitions, modules, variables
+// and custom functions. zero Compiler compiles expressions with only custom
+// functions and $ENV.
+type Compiler struct {
+	config Config
+	// names and values of the variables, names are prefixed with '$'
+	names   []string
+	values  []any
+	options []gojq.CompilerOption
+}
+
+// NewCompiler returns compiler of the config and the variables, dir is the
+// directory of the config file.
+func NewCompiler(config Config, variables []Variable, dir string) (*Compiler, error) {
+	c, valueErrs, err := newCompiler(config, variables, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(valueErrs) > 0 {
+		return nil, valueErrs[0]
+	}
+	return c, nil
+}
+
+// CheckCompiler returns compiler of the config to check the expressions, unlike
+// NewCompiler values of the variables which can't be read, e.g. env variables
+// not set in CI, are reported and an empty placeholder value is used instead.
+// compiler is nil if the config or the variables are invalid.
+func CheckCompiler(config Config, variables []Variable, dir string) (*Compiler, []error) {
+	c, valueErrs, err := newCompiler(config, variables, dir)
+	if err != nil {
+		return nil, append(valueErrs, err)
+	}
+	return c, valueErrs
+}
+
+// newCompiler returns compiler of the config, errors of the variable values are
+// returned separately and an empty value is used for those variables.
+func newCompiler(config Config, variables []Variable, dir string) (*Compiler, []error, error) {
+	c := &Compiler{config: config}
+
+	var valueErrs []error
+	for _, v := range variables {
+		if err := validateVariable(v); err != nil {
+			return nil, valueErrs, err
+		}
+		if slices.Contains(c.names, "$"+v.Name) {
+			return nil, valueErrs, fmt.Errorf("variable names must be unique duplicate found variable:%s", v.Name)
+		}
+		value, err := v.value(dir)
+		if err != nil {
+			valueErrs = append(valueErrs, fmt.Errorf("unable to get value of variable:%s err:%w", v.Name, err))
+		}
+		c.names = append(c.names, "$"+v.Name)
+		c.values = append(c.values, value)
+	}
+	if len(c.names) > 0 {
+		c.options = append(c.options, gojq.WithVariables(c.names))
+	}
+
+	if config.Definitions != "" {
+		if _, err := gojq.Parse(config.Definitions + " ."); err != nil {
+			return nil, valueErrs, fmt.Errorf("unable to parse jq definitions err:%w", err)
+		}
+	}
+
+	if len(config.LibraryPaths) > 0 {
+		var paths []string
+		for _, p := range config.LibraryPaths {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			paths = append(paths, p)
+		}
+		c.options = append(c.options, gojq.WithModuleLoader(gojq.NewModuleLoader(paths)))
+	}
+
+	return c, valueErrs, nil
+}
+
+// Config returns the config of the compiler
+func (c *Compiler) Config() Config {
+	return c.config
+}
+
+// Variables returns the values of the variables by name
+func (c *Compiler) Variables() map[string]any {
+	variables := make(map[string]any)
+	for i, n := range c.names {
+		variables[strings.TrimPrefix(n, "$")] = c.values[i]
+	}
+	return variables
+}
+
+// Compile parses and compiles the expression, empty expression is identity.
+func (c *Compiler) Compile(exp string) (*Code, error) {
+	if exp == "" {
+		exp = "."
+	}
+	query, err := gojq.Parse(exp)
+	if err != nil {
+		return nil, fmt.Errorf("jq query parse error %w", err)
+	}
+
+	// definitions are parsed for every expression as query may be modified
+	// by the compiler. imports must precede definitions.
+	if c.config.Definitions != "" {
+		defs, err := gojq.Parse(c.config.Definitions + " .")
+		if err != nil {
+			return nil, fmt.Errorf("jq definitions parse error %w", err)
+		}
+		query.Imports = append(defs.Imports, query.Imports...)
+		query.FuncDefs = append(defs.FuncDefs, query.FuncDefs...)
+	}
+
+	options := append(Functions(), gojq.WithEnvironLoader(os.Environ))
+	code, err := gojq.Compile(query, append(options, c.options...)...)
+	if err != nil {
+		return nil, fmt.Errorf("jq query compile error %w", err)
+	}
+
+	return &Code{code: code, values: c.values}, nil
+}
+
+// Code is a compiled jq expression along with the values of its variables
+type Code struct {
+	code   *gojq.Code
+	values []any
+}
+
+// Run runs the code with the input
+func (c *Code) Run(v any) gojq.Iter {
+	return c.code.Run(v, c.values...)
+}
+
+// RunWithContext runs the code with the input and context
+func (c *Code) RunWithContext(ctx context.Context, v any) gojq.Iter {
+	return c.code.RunWithContext(ctx, v, c.values...)
+}
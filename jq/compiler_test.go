@@ -0,0 +1,72 @@
+package jq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompiler_Compile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	module := `def app_id: .target[] | select(.type == "AppInstance") | .alternateId;`
+	if err := os.WriteFile(filepath.Join(dir, "lib", "okta.jq"), []byte(module), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]any{
+		"name":   "Example",
+		"target": []any{map[string]any{"type": "AppInstance", "alternateId": "hr"}},
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		exp     string
+		want    any
+		wantErr bool
+	}{
+		{"no-config", Config{}, `.name`, "Example", false},
+		{"empty-expression", Config{}, ``, input, false},
+		{"custom-functions", Config{}, `.name | sha256 | .[0:8]`, "d029f87e", false},
+		{"definitions", Config{Definitions: `def lower_name: .name | ascii_downcase;`}, `lower_name`, "example", false},
+		{"definitions-with-args", Config{Definitions: `def prefix(p): p + .name;`}, `prefix("app-")`, "app-Example", false},
+		{"expression-definitions", Config{Definitions: `def a: 1;`}, `def b: 2; a + b`, 3, false},
+		{"undefined-function", Config{}, `lower_name`, nil, true},
+		{"import", Config{LibraryPaths: []string{"lib"}}, `import "okta" as okta; okta::app_id`, "hr", false},
+		{"include-in-definitions", Config{Definitions: `include "okta";`, LibraryPaths: []string{filepath.Join(dir, "lib")}}, `app_id`, "hr", false},
+		{"unknown-module", Config{LibraryPaths: []string{"lib"}}, `import "missing" as m; m::a`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCompiler(tt.config, nil, dir)
+			if err != nil {
+				t.Fatalf("NewCompiler() error = %v", err)
+			}
+			code, err := c.Compile(tt.exp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compiler.Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _ := code.Run(input).Next()
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Compiler.Compile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewCompiler(t *testing.T) {
+	if _, err := NewCompiler(Config{Definitions: `def a: 1`}, nil, ""); err == nil {
+		t.Errorf("NewCompiler() error = nil, want error for invalid definitions")
+	}
+	if _, err := NewCompiler(Config{Definitions: `def a: 1; def b: a;`}, nil, ""); err != nil {
+		t.Errorf("NewCompiler() error = %v", err)
+	}
+}
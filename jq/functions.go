@@ -0,0 +1,184 @@
+// Package jq provides custom jq functions available in all the jq expressions
+// of the exporter.
+package jq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/itchyny/gojq"
+)
+
+// byteUnits are the multipliers of the units supported by parse_bytes, units
+// are case insensitive
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"p":   1e15,
+	"pb":  1e15,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+	"pi":  1 << 50,
+	"pib": 1 << 50,
+}
+
+// maxRegexps is the max number of compiled expressions cached by
+// regex_extract, once reached new patterns are compiled on every call so that
+// patterns taken from the payloads can't grow the cache without limit.
+const maxRegexps = 1000
+
+// regexps caches the compiled expressions of regex_extract by pattern
+var regexps = struct {
+	sync.RWMutex
+	cache map[string]*regexp.Regexp
+}{cache: make(map[string]*regexp.Regexp)}
+
+// now is replaced in tests
+var now = time.Now
+
+// Functions returns compiler options registering all the custom functions
+func Functions() []gojq.CompilerOption {
+	return []gojq.CompilerOption{
+		// parse_rfc3339 returns epoch seconds of RFC3339 time, unlike
+		// fromdateiso8601 it supports fractional seconds and offsets
+		gojq.WithFunction("parse_rfc3339", 0, 0, stringFunc(parseRFC3339)),
+		// parse_duration returns seconds of a duration like "1h5m"
+		gojq.WithFunction("parse_duration", 0, 0, stringFunc(parseDuration)),
+		// parse_bytes returns bytes of a size like "10MiB" or "1.5 GB"
+		gojq.WithFunction("parse_bytes", 0, 0, stringFunc(parseBytes)),
+		// sha256 returns hex encoded sha256 digest of a string
+		gojq.WithFunction("sha256", 0, 0, stringFunc(func(s string) (any, error) {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:]), nil
+		})),
+		// regex_extract returns first capture group of the first match of
+		// the regex, or whole match if regex has no groups. null if no match
+		gojq.WithFunction("regex_extract", 1, 1, regexExtract),
+		// now_unix returns current epoch seconds
+		gojq.WithFunction("now_unix", 0, 0, func(any, []any) any {
+			return float64(now().UnixNano()) / 1e9
+		}),
+	}
+}
+
+// stringFunc returns jq function of fn which only accepts string input
+func stringFunc(fn func(string) (any, error)) func(any, []any) any {
+	return func(v any, _ []any) any {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a string but got: %T (%v)", v, v)
+		}
+		r, err := fn(s)
+		if err != nil {
+			return err
+		}
+		return r
+	}
+}
+
+func parseRFC3339(s string) (any, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse rfc3339 time err:%w", err)
+	}
+	return float64(t.UnixNano()) / 1e9, nil
+}
+
+func parseDuration(s string) (any, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse duration err:%w", err)
+	}
+	return d.Seconds(), nil
+}
+
+func parseBytes(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsSpace(r)
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse bytes value:%q err:%w", s, err)
+	}
+	unit := strings.ToLower(strings.TrimSpace(s[i:]))
+	m, ok := byteUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("unable to parse bytes value:%q err:unknown unit:%s", s, unit)
+	}
+	return n * m, nil
+}
+
+// compileRegex returns the cached expression of the pattern, the compiled
+// expression is cached if the cache isn't full.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexps.RLock()
+	re, ok := regexps.cache[pattern]
+	regexps.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexps.Lock()
+	if len(regexps.cache) < maxRegexps {
+		regexps.cache[pattern] = re
+	}
+	regexps.Unlock()
+	return re, nil
+}
+
+func regexExtract(v any, args []any) any {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("expected a string but got: %T (%v)", v, v)
+	}
+	pattern, ok := args[0].(string)
+	if !ok {
+		return fmt.Errorf("regex must be a string but got: %T (%v)", args[0], args[0])
+	}
+
+	re, err := compileRegex(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex err:%w", err)
+	}
+
+	match := re.FindStringSubmatch(s)
+	switch {
+	case match == nil:
+		return nil
+	case len(match) > 1:
+		return match[1]
+	default:
+		return match[0]
+	}
+}
@@ -0,0 +1,88 @@
+package jq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/itchyny/gojq"
+)
+
+func run(t *testing.T, exp string, input any) any {
+	t.Helper()
+	query, err := gojq.Parse(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, Functions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := code.Run(input).Next()
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+func TestFunctions(t *testing.T) {
+	now = func() time.Time { return time.Unix(1702980137, 500_000_000) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name  string
+		exp   string
+		input any
+		want  any
+	}{
+		{"parse_rfc3339", `parse_rfc3339`, "2023-12-19T09:42:17Z", float64(1702978937)},
+		{"parse_rfc3339-fraction", `parse_rfc3339`, "2020-12-11T01:00:52.605001Z", 1607648452.605001},
+		{"parse_rfc3339-offset", `parse_rfc3339`, "2023-12-19T10:42:17+01:00", float64(1702978937)},
+		{"parse_rfc3339-invalid", `parse_rfc3339`, "2023-12-19", `unable to parse rfc3339 time err:parsing time "2023-12-19" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "" as "T"`},
+		{"parse_rfc3339-not-string", `parse_rfc3339`, 1, "expected a string but got: int (1)"},
+		{"parse_duration", `parse_duration`, "1h5m", float64(3900)},
+		{"parse_duration-fraction", `parse_duration`, "1.5s", 1.5},
+		{"parse_duration-invalid", `parse_duration`, "1d", `unable to parse duration err:time: unknown unit "d" in duration "1d"`},
+		{"parse_bytes", `parse_bytes`, "10MiB", float64(10 << 20)},
+		{"parse_bytes-decimal", `parse_bytes`, "1.5 GB", float64(1.5e9)},
+		{"parse_bytes-lowercase", `parse_bytes`, "2kib", float64(2048)},
+		{"parse_bytes-no-unit", `parse_bytes`, "512", float64(512)},
+		{"parse_bytes-unknown-unit", `parse_bytes`, "10 XB", `unable to parse bytes value:"10 XB" err:unknown unit:xb`},
+		{"parse_bytes-invalid", `parse_bytes`, "MiB", `unable to parse bytes value:"MiB" err:strconv.ParseFloat: parsing "": invalid syntax`},
+		{"sha256", `sha256`, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha256-not-string", `sha256`, nil, "expected a string but got: <nil> (<nil>)"},
+		{"regex_extract-group", `regex_extract("id=(\\d+)")`, "user id=42 name=a", "42"},
+		{"regex_extract-match", `regex_extract("\\d+")`, "v1.23", "1"},
+		{"regex_extract-no-match", `regex_extract("id=(\\d+)")`, "name=a", nil},
+		{"regex_extract-invalid", `regex_extract("(")`, "a", "invalid regex err:error parsing regexp: missing closing ): `(`"},
+		{"now_unix", `now_unix`, nil, 1702980137.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, run(t, tt.exp, tt.input)); diff != "" {
+				t.Errorf("%s mismatch (-want +got):\n%s", tt.exp, diff)
+			}
+		})
+	}
+}
+
+func Test_compileRegex(t *testing.T) {
+	// patterns taken from the payloads don't grow the cache beyond its size
+	for i := range maxRegexps + 10 {
+		re, err := compileRegex(fmt.Sprintf("id=%d", i))
+		if err != nil {
+			t.Fatalf("compileRegex() error = %v", err)
+		}
+		if !re.MatchString(fmt.Sprintf("id=%d", i)) {
+			t.Errorf("compileRegex() regex:%s doesn't match", re)
+		}
+	}
+	if got := len(regexps.cache); got != maxRegexps {
+		t.Errorf("compileRegex() cached %v expressions, want %v", got, maxRegexps)
+	}
+
+	if _, err := compileRegex("("); err == nil {
+		t.Errorf("compileRegex() error = nil, want error")
+	}
+}
@@ -0,0 +1,68 @@
+package jq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var variableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Variable is a value exposed as $name to all the expressions, only one of
+// Value, ValueFromEnv or ValueFromFile can be set
+type Variable struct {
+	Name          string `yaml:"name"`
+	Value         string `yaml:"value"`
+	ValueFromEnv  string `yaml:"valueFromEnv"`
+	ValueFromFile string `yaml:"valueFromFile"`
+}
+
+// value returns value of the variable, relative file path is relative to dir.
+// leading and trailing white space of the file content is removed.
+func (v Variable) value(dir string) (string, error) {
+	switch {
+	case v.ValueFromEnv != "":
+		value, ok := os.LookupEnv(v.ValueFromEnv)
+		if !ok {
+			return "", fmt.Errorf("env variable not set env:%s", v.ValueFromEnv)
+		}
+		return value, nil
+
+	case v.ValueFromFile != "":
+		path := v.ValueFromFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+
+	default:
+		return v.Value, nil
+	}
+}
+
+func validateVariable(v Variable) error {
+	if !variableNameRegex.MatchString(v.Name) {
+		return fmt.Errorf("invalid variable name:%q", v.Name)
+	}
+	// $ENV is always defined
+	if v.Name == "ENV" {
+		return fmt.Errorf("variable name ENV is reserved")
+	}
+
+	var sources int
+	for _, s := range []string{v.Value, v.ValueFromEnv, v.ValueFromFile} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of value, valueFromEnv or valueFromFile can be set variable:%s", v.Name)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package jq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewCompiler_variables(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "region"), []byte("eu-west-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_JQ_CLUSTER", "prod-1")
+
+	tests := []struct {
+		name      string
+		variables []Variable
+		exp       string
+		want      any
+		wantErr   bool
+	}{
+		{"value", []Variable{{Name: "env", Value: "prod"}}, `$env`, "prod", false},
+		{"value-from-env", []Variable{{Name: "cluster", ValueFromEnv: "TEST_JQ_CLUSTER"}}, `$cluster`, "prod-1", false},
+		{"value-from-file", []Variable{{Name: "region", ValueFromFile: "region"}}, `$region`, "eu-west-1", false},
+		{"multiple", []Variable{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}, `$a + $b`, "12", false},
+		{"empty-value", []Variable{{Name: "empty"}}, `$empty`, "", false},
+		{"env", nil, `$ENV.TEST_JQ_CLUSTER`, "prod-1", false},
+		{"env-function", nil, `env.TEST_JQ_CLUSTER`, "prod-1", false},
+		{"undefined", nil, `$cluster`, nil, true},
+		{"unset-env", []Variable{{Name: "cluster", ValueFromEnv: "TEST_JQ_UNSET"}}, `$cluster`, nil, true},
+		{"missing-file", []Variable{{Name: "region", ValueFromFile: "missing"}}, `$region`, nil, true},
+		{"duplicate", []Variable{{Name: "a", Value: "1"}, {Name: "a", Value: "2"}}, `$a`, nil, true},
+		{"invalid-name", []Variable{{Name: "a-b", Value: "1"}}, `.`, nil, true},
+		{"reserved-name", []Variable{{Name: "ENV", Value: "1"}}, `.`, nil, true},
+		{"multiple-sources", []Variable{{Name: "a", Value: "1", ValueFromEnv: "TEST_JQ_CLUSTER"}}, `$a`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCompiler(Config{}, tt.variables, dir)
+			if err == nil {
+				var code *Code
+				code, err = c.Compile(tt.exp)
+				if err == nil {
+					got, _ := code.Run(nil).Next()
+					if diff := cmp.Diff(tt.want, got); diff != "" {
+						t.Errorf("Compiler.Compile() mismatch (-want +got):\n%s", diff)
+					}
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCompiler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckCompiler(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		variables    []Variable
+		wantErrs     int
+		wantCompiler bool
+	}{
+		{"valid", []Variable{{Name: "env", Value: "prod"}}, 0, true},
+		{"unset-env", []Variable{{Name: "cluster", ValueFromEnv: "TEST_JQ_UNSET"}}, 1, true},
+		{"unset-env-and-missing-file", []Variable{
+			{Name: "cluster", ValueFromEnv: "TEST_JQ_UNSET"},
+			{Name: "region", ValueFromFile: "missing"},
+		}, 2, true},
+		{"invalid-name", []Variable{{Name: "cluster", ValueFromEnv: "TEST_JQ_UNSET"}, {Name: "a-b", Value: "1"}}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, errs := CheckCompiler(Config{}, tt.variables, dir)
+			if len(errs) != tt.wantErrs {
+				t.Errorf("CheckCompiler() errors = %v, want %d errors", errs, tt.wantErrs)
+			}
+			if (c != nil) != tt.wantCompiler {
+				t.Fatalf("CheckCompiler() compiler = %v, want compiler %v", c, tt.wantCompiler)
+			}
+			if c == nil {
+				return
+			}
+			// placeholder value is used for the variables which can't be read
+			for _, v := range tt.variables {
+				code, err := c.Compile("$" + v.Name)
+				if err != nil {
+					t.Fatalf("Compiler.Compile() error = %v", err)
+				}
+				got, _ := code.Run(nil).Next()
+				if got != v.Value {
+					t.Errorf("Compiler.Compile() $%s = %v, want %q", v.Name, got, v.Value)
+				}
+			}
+		})
+	}
+}
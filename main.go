@@ -9,22 +9,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/utilitywarehouse/json_exporter/collector"
 	"github.com/utilitywarehouse/json_exporter/webhook"
 )
 
 var (
-	log               *slog.Logger
-	logLevel          string
-	address           string
-	metricPath        string
-	configPath        string
-	exporterNamespace string
+	log                 *slog.Logger
+	logLevel            string
+	address             string
+	metricPath          string
+	configPath          string
+	exporterNamespace   string
+	stateFile           string
+	stateInterval       time.Duration
+	configWatchInterval time.Duration
+	enableReload        bool
 )
 
 func usage() {
@@ -34,12 +38,21 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "DESCRIPTION:\n")
 	fmt.Fprintf(os.Stderr, "\tA prometheus exporter which collects metrics from JSON using jq path expression\n")
 
+	fmt.Fprintf(os.Stderr, "COMMANDS:\n")
+	fmt.Fprintf(os.Stderr, "\tcheck-config <file>          validate config file and print all the errors found\n")
+	fmt.Fprintf(os.Stderr, "\teval [payload.json...]        print metrics of the payloads, see eval --help\n")
+	fmt.Fprintf(os.Stderr, "\ttest <tests.yaml>...          run unit tests of the config\n")
+
 	fmt.Fprintf(os.Stderr, "OPTIONS:\n")
 	fmt.Fprintf(os.Stderr, "\t--log-level                  (default: info)               [$LOG_LEVEL]\n")
 	fmt.Fprintf(os.Stderr, "\t--listen-address             (default: :9000)              [$LISTEN_ADDRESS]\n")
 	fmt.Fprintf(os.Stderr, "\t--metrics-path               (default: /metrics)           [$METRICS_PATH]\n")
 	fmt.Fprintf(os.Stderr, "\t--exporter-config            (default: json-exporter.yaml) [$EXPORTER_CONFIG]\n")
+	fmt.Fprintf(os.Stderr, "\t--config-watch-interval      (default: disabled)           [$CONFIG_WATCH_INTERVAL]\n")
+	fmt.Fprintf(os.Stderr, "\t--enable-reload-endpoint     (default: false)              [$ENABLE_RELOAD_ENDPOINT]\n")
 	fmt.Fprintf(os.Stderr, "\t--exporter-metrics-namespace (default: json_exporter)      [$EXPORTER_METRICS_NAMESPACE]\n")
+	fmt.Fprintf(os.Stderr, "\t--state-file                 (default: disabled)           [$STATE_FILE]\n")
+	fmt.Fprintf(os.Stderr, "\t--state-snapshot-interval    (default: 1m)                 [$STATE_SNAPSHOT_INTERVAL]\n")
 	os.Exit(2)
 }
 
@@ -56,18 +69,51 @@ func checkEnvOverride() {
 	if env := os.Getenv("EXPORTER_CONFIG"); env != "" {
 		configPath = env
 	}
+	if env := os.Getenv("CONFIG_WATCH_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil {
+			configWatchInterval = d
+		}
+	}
+	if env := os.Getenv("ENABLE_RELOAD_ENDPOINT"); env != "" {
+		if b, err := strconv.ParseBool(env); err == nil {
+			enableReload = b
+		}
+	}
 	if env := os.Getenv("EXPORTER_METRICS_NAMESPACE"); env != "" {
 		exporterNamespace = env
 	}
+	if env := os.Getenv("STATE_FILE"); env != "" {
+		stateFile = env
+	}
+	if env := os.Getenv("STATE_SNAPSHOT_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil {
+			stateInterval = d
+		}
+	}
 }
 
 func main() {
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-config":
+			os.Exit(checkConfig(os.Args[2:], os.Stdout, os.Stderr))
+		case "eval":
+			os.Exit(evalPayloads(os.Args[2:], os.Stdout, os.Stderr))
+		case "test":
+			os.Exit(unitTest(os.Args[2:]))
+		}
+	}
+
 	flag.StringVar(&logLevel, "log-level", "info", "log level")
 	flag.StringVar(&address, "listen-address", ":9000", "address the web server binds to")
 	flag.StringVar(&metricPath, "metrics-path", "/metrics", "path under which to expose metrics")
 	flag.StringVar(&configPath, "exporter-config", "json-exporter.yaml", "exporter config file path")
+	flag.DurationVar(&configWatchInterval, "config-watch-interval", 0, "interval of checking config file for changes, disabled if 0")
+	flag.BoolVar(&enableReload, "enable-reload-endpoint", false, "enable reloading config with POST request on "+reloadPath)
 	flag.StringVar(&exporterNamespace, "exporter-metrics-namespace", "json_exporter", "exporter's metrics namespace")
+	flag.StringVar(&stateFile, "state-file", "", "file path to persist series across restarts, disabled if empty")
+	flag.DurationVar(&stateInterval, "state-snapshot-interval", time.Minute, "interval of saving series to the state file")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -89,7 +135,12 @@ func main() {
 
 	log = slog.Default()
 
+	// reg holds exporter's own metrics, metrics of the collectors are
+	// registered to a new registry on every config reload
 	reg := prometheus.NewRegistry()
+	collector.InitMetrics(reg, exporterNamespace)
+	webhook.InitMetrics(reg, exporterNamespace)
+
 	mux := http.NewServeMux()
 	server := &http.Server{
 		Addr:              address,
@@ -102,43 +153,54 @@ func main() {
 
 	go gracefulShutdown(cancel, server)
 
-	// collectorInputs is a map of collector id to its input channel
-	// shared with webhooks
-	collectorInputs := make(map[string]chan any)
+	rl := newReloader(ctx, reg, log)
 
-	collectors, err := collector.New(configPath, reg, log, exporterNamespace)
+	gen, err := rl.load(nil)
 	if err != nil {
-		log.Error("unable to load collectors", "err", err)
+		log.Error("unable to load config", "err", err)
 		os.Exit(1)
 	}
 
-	for id, collector := range collectors {
-		collectorInputs[id] = collector.Input
-		log.Info("starting scrapper", "collector", id)
-		go collector.Start(ctx)
+	// restore series before webhooks start sending payloads
+	stateDone := make(chan struct{})
+	if stateFile != "" {
+		rl.state = collector.NewStateStore(stateFile, stateInterval, gen.collectors, reg, log)
+		if err := rl.state.Restore(); err != nil {
+			log.Error("unable to restore state", "err", err)
+		}
+		go func() {
+			rl.state.Start(ctx)
+			close(stateDone)
+		}()
+	} else {
+		close(stateDone)
 	}
 
-	webhooks, err := webhook.New(configPath, reg, log, collectorInputs, exporterNamespace)
-	if err != nil {
-		log.Error("unable to load webhooks", "err", err)
-		os.Exit(1)
-	}
+	rl.activate(gen)
+	rl.lastReloadSuccessful.Set(1)
+	rl.lastReloadSuccessTimestamp.SetToCurrentTime()
 
-	// register webhook handlers
-	for id, wh := range webhooks {
-		log.Info("registering webhook", "id", id)
-		mux.Handle(wh.Path, wh)
+	go rl.watchSignal(ctx)
+	if configWatchInterval > 0 {
+		go rl.watchFile(ctx, configWatchInterval)
 	}
 
-	mux.Handle(metricPath, promhttp.HandlerFor(reg,
-		promhttp.HandlerOpts{Registry: reg},
-	))
+	// reload endpoint is served on the same listener as the webhooks so it's
+	// only enabled if requested
+	if enableReload {
+		mux.HandleFunc(reloadPath, rl.reloadHandler)
+	}
+	// webhooks and metrics are served by the current config generation
+	mux.Handle("/", rl)
 
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Error("unable to start server", "err", err)
 		os.Exit(1)
 	}
 
+	// wait for the final state snapshot
+	<-stateDone
+
 }
 
 // controlled shutdown when terminate signal received.
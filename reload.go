@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/webhook"
+)
+
+const reloadPath = "/-/reload"
+
+// generation holds the collectors and the handler of webhooks and metrics
+// of a loaded config
+type generation struct {
+	// mu is held for reading while a request is served by the generation,
+	// once closed is set generation is replaced and doesn't serve requests
+	mu     sync.RWMutex
+	closed bool
+
+	mux        *http.ServeMux
+	collectors map[string]*collector.JSONCollector
+	webhooks   map[string]*webhook.WebHookHandler
+}
+
+// reloader loads the config and replaces the serving generation on reload.
+// a failed reload keeps the current generation.
+type reloader struct {
+	ctx context.Context
+	log *slog.Logger
+	// reg is the registry of exporter's own metrics, metrics of the
+	// collectors are registered to a new registry for every generation
+	reg   *prometheus.Registry
+	state *collector.StateStore
+
+	// mu serialises reloads
+	mu         sync.Mutex
+	current    atomic.Pointer[generation]
+	configHash [sha256.Size]byte
+
+	lastReloadSuccessful       prometheus.Gauge
+	lastReloadSuccessTimestamp prometheus.Gauge
+}
+
+func newReloader(ctx context.Context, reg *prometheus.Registry, log *slog.Logger) *reloader {
+	rl := &reloader{
+		ctx: ctx,
+		log: log,
+		reg: reg,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: exporterNamespace,
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: exporterNamespace,
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+	}
+	reg.MustRegister(rl.lastReloadSuccessful, rl.lastReloadSuccessTimestamp)
+	return rl
+}
+
+// load loads a new generation from the config file. metrics and dedup state
+// of the previous generation are reused if their config is unchanged.
+func (rl *reloader) load(previous *generation) (*generation, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config err:%w", err)
+	}
+
+	metricsReg := prometheus.NewRegistry()
+
+	var previousCollectors map[string]*collector.JSONCollector
+	var previousWebhooks map[string]*webhook.WebHookHandler
+	if previous != nil {
+		previousCollectors, previousWebhooks = previous.collectors, previous.webhooks
+	}
+
+	// config is read once so that the hash is of the loaded config
+	dir := filepath.Dir(configPath)
+	collectors, err := collector.LoadData(data, dir, metricsReg, rl.log, previousCollectors)
+	if err != nil {
+		return nil, err
+	}
+
+	// collectorInputs is a map of collector id to its input shared with webhooks
+	collectorInputs := make(map[string]webhook.Input)
+	for id, c := range collectors {
+		collectorInputs[id] = c
+	}
+
+	webhooks, err := webhook.LoadData(data, dir, rl.log, collectorInputs, previousWebhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	for id, wh := range webhooks {
+		if wh.Path == metricPath || wh.Path == reloadPath {
+			return nil, fmt.Errorf("webhook path is reserved id:%s path:%s", id, wh.Path)
+		}
+		mux.Handle(wh.Path, wh)
+	}
+
+	// the exposition format is negotiated with the scraper using the Accept
+	// header. native histograms are only exposed in protobuf format which
+	// prometheus requests when scraping of native histograms is enabled.
+	mux.Handle(metricPath, promhttp.HandlerFor(
+		prometheus.Gatherers{rl.reg, metricsReg},
+		promhttp.HandlerOpts{Registry: rl.reg},
+	))
+
+	rl.configHash = sha256.Sum256(data)
+
+	return &generation{mux: mux, collectors: collectors, webhooks: webhooks}, nil
+}
+
+// activate starts the collectors of the generation and makes it the serving
+// generation
+func (rl *reloader) activate(gen *generation) {
+	for id, c := range gen.collectors {
+		rl.log.Info("starting scrapper", "collector", id)
+		go c.Start(rl.ctx)
+	}
+	rl.current.Store(gen)
+	if rl.state != nil {
+		rl.state.SetCollectors(gen.collectors)
+	}
+}
+
+// reload loads the config and replaces the current generation. collectors of
+// the old generation are stopped once its in-flight requests are served and
+// the queued payloads are processed.
+func (rl *reloader) reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	old := rl.current.Load()
+
+	gen, err := rl.load(old)
+	if err != nil {
+		rl.lastReloadSuccessful.Set(0)
+		return err
+	}
+
+	rl.activate(gen)
+
+	old.mu.Lock()
+	old.closed = true
+	old.mu.Unlock()
+
+	for _, c := range old.collectors {
+		c.Stop()
+	}
+
+	rl.lastReloadSuccessful.Set(1)
+	rl.lastReloadSuccessTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// ServeHTTP serves the request with the current generation
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for !rl.serve(rl.current.Load(), w, r) {
+	}
+}
+
+// serve returns false without serving the request if generation is closed
+func (rl *reloader) serve(gen *generation, w http.ResponseWriter, r *http.Request) bool {
+	gen.mu.RLock()
+	defer gen.mu.RUnlock()
+
+	if gen.closed {
+		return false
+	}
+	gen.mux.ServeHTTP(w, r)
+	return true
+}
+
+// reloadHandler reloads the config on POST requests
+func (rl *reloader) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := rl.reload(); err != nil {
+		rl.log.Error("unable to reload config", "trigger", "http", "err", err)
+		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	rl.log.Info("config reloaded", "trigger", "http")
+}
+
+// watchSignal reloads the config when SIGHUP is received
+func (rl *reloader) watchSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := rl.reload(); err != nil {
+				rl.log.Error("unable to reload config", "trigger", "signal", "err", err)
+				continue
+			}
+			rl.log.Info("config reloaded", "trigger", "signal")
+		}
+	}
+}
+
+// watchFile reloads the config when content of the config file is changed
+func (rl *reloader) watchFile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				rl.log.Error("unable to read config", "err", err)
+				continue
+			}
+
+			rl.mu.Lock()
+			changed := sha256.Sum256(data) != rl.configHash
+			rl.mu.Unlock()
+			if !changed {
+				continue
+			}
+
+			if err := rl.reload(); err != nil {
+				rl.log.Error("unable to reload config", "trigger", "file", "err", err)
+				// avoid retrying same config on every tick
+				rl.mu.Lock()
+				rl.configHash = sha256.Sum256(data)
+				rl.mu.Unlock()
+				continue
+			}
+			rl.log.Info("config reloaded", "trigger", "file")
+		}
+	}
+}
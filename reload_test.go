@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/webhook"
+)
+
+func TestMain(m *testing.M) {
+	exporterNamespace = "test_json"
+	collector.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+	webhook.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+	os.Exit(m.Run())
+}
+
+// newTestReloader returns a reloader of a config file written by the
+// returned function
+func newTestReloader(t *testing.T) (*reloader, func(config string)) {
+	t.Helper()
+
+	configPath = filepath.Join(t.TempDir(), "config.yaml")
+	metricPath = "/metrics"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	writeConfig := func(config string) {
+		if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+			t.Fatalf("unable to write config err:%v", err)
+		}
+	}
+	rl := newReloader(ctx, prometheus.NewPedanticRegistry(), slog.Default())
+
+	// collectors are stopped before exporter's metrics are initialised again
+	// by other tests
+	t.Cleanup(func() {
+		if gen := rl.current.Load(); gen != nil {
+			for _, c := range gen.collectors {
+				c.Stop()
+			}
+		}
+	})
+	return rl, writeConfig
+}
+
+func testConfig(webhookPath string) string {
+	return `
+collectors:
+  example:
+    namespace: test
+    metrics:
+      - name: events_total
+webhooks:
+  example:
+    method: POST
+    path: ` + webhookPath + `
+    collectors:
+      - id: example
+`
+}
+
+func serve(rl *reloader, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	rl.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func Test_reloader_reload(t *testing.T) {
+	rl, writeConfig := newTestReloader(t)
+
+	writeConfig(testConfig("/v1"))
+	gen, err := rl.load(nil)
+	if err != nil {
+		t.Fatalf("reloader.load() error = %v", err)
+	}
+	rl.activate(gen)
+
+	if got := serve(rl, http.MethodPost, "/v1", `{}`).Code; got != http.StatusOK {
+		t.Errorf("POST /v1 status = %v, want %v", got, http.StatusOK)
+	}
+
+	writeConfig(testConfig("/v2"))
+	if err := rl.reload(); err != nil {
+		t.Fatalf("reloader.reload() error = %v", err)
+	}
+	if rl.configHash != sha256.Sum256([]byte(testConfig("/v2"))) {
+		t.Error("reloader.reload() config hash doesn't match the loaded config")
+	}
+
+	// old generation is replaced and doesn't serve requests
+	if rl.current.Load() == gen {
+		t.Fatal("reloader.reload() didn't replace the generation")
+	}
+	gen.mu.RLock()
+	closed := gen.closed
+	gen.mu.RUnlock()
+	if !closed {
+		t.Error("reloader.reload() didn't close the old generation")
+	}
+
+	for _, tt := range []struct {
+		path string
+		want int
+	}{
+		{"/v1", http.StatusNotFound},
+		{"/v2", http.StatusOK},
+	} {
+		if got := serve(rl, http.MethodPost, tt.path, `{}`).Code; got != tt.want {
+			t.Errorf("POST %s status = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if body := serve(rl, http.MethodGet, "/metrics", "").Body.String(); !strings.Contains(body, "test_json_config_last_reload_successful 1") {
+		t.Errorf("GET /metrics = %s, want successful reload", body)
+	}
+}
+
+func Test_reloader_reload_failed(t *testing.T) {
+	rl, writeConfig := newTestReloader(t)
+
+	writeConfig(testConfig("/v1"))
+	gen, err := rl.load(nil)
+	if err != nil {
+		t.Fatalf("reloader.load() error = %v", err)
+	}
+	rl.activate(gen)
+
+	writeConfig(`collectors: [`)
+	if err := rl.reload(); err == nil {
+		t.Fatal("reloader.reload() error = nil, want error")
+	}
+
+	// current generation keeps serving the old config
+	if rl.current.Load() != gen {
+		t.Fatal("reloader.reload() replaced the generation")
+	}
+	if got := serve(rl, http.MethodPost, "/v1", `{}`).Code; got != http.StatusOK {
+		t.Errorf("POST /v1 status = %v, want %v", got, http.StatusOK)
+	}
+	if body := serve(rl, http.MethodGet, "/metrics", "").Body.String(); !strings.Contains(body, "test_json_config_last_reload_successful 0") {
+		t.Errorf("GET /metrics = %s, want failed reload", body)
+	}
+}
+
+func Test_reloader_load_reservedPath(t *testing.T) {
+	for _, path := range []string{"/metrics", "/-/reload"} {
+		t.Run(path, func(t *testing.T) {
+			rl, writeConfig := newTestReloader(t)
+
+			writeConfig(testConfig(path))
+			if _, err := rl.load(nil); err == nil {
+				t.Errorf("reloader.load() error = nil, want reserved path error")
+			}
+		})
+	}
+}
+
+func Test_reloader_reloadHandler(t *testing.T) {
+	rl, writeConfig := newTestReloader(t)
+
+	writeConfig(testConfig("/v1"))
+	gen, err := rl.load(nil)
+	if err != nil {
+		t.Fatalf("reloader.load() error = %v", err)
+	}
+	rl.activate(gen)
+
+	for _, tt := range []struct {
+		method string
+		want   int
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed},
+		{http.MethodPost, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		rl.reloadHandler(rec, httptest.NewRequest(tt.method, reloadPath, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s status = %v, want %v", tt.method, reloadPath, rec.Code, tt.want)
+		}
+	}
+}
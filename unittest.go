@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/webhook"
+	"gopkg.in/yaml.v2"
+)
+
+var commentLineReg = regexp.MustCompile(`(?m)^\s*#.*$`)
+
+// testFile is the file of unit tests of a config
+type testFile struct {
+	// Config is the path of the config, relative path is relative to the test file
+	Config string     `yaml:"config"`
+	Tests  []testCase `yaml:"tests"`
+}
+
+type testCase struct {
+	Name     string        `yaml:"name"`
+	Requests []testRequest `yaml:"requests"`
+	// ExpectedMetrics are the series of all the metrics of the config after
+	// the requests in prometheus text format, comments are ignored
+	ExpectedMetrics string `yaml:"expectedMetrics"`
+}
+
+type testRequest struct {
+	Path    string            `yaml:"path"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	// only one of Body or BodyFile can be set, relative BodyFile is relative
+	// to the test file
+	Body     string `yaml:"body"`
+	BodyFile string `yaml:"bodyFile"`
+	// ExpectedStatus is the expected response code, not checked if 0
+	ExpectedStatus int `yaml:"expectedStatus"`
+}
+
+// unitTest runs the tests of the test files, it returns the exit code of the
+// test command.
+func unitTest(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: json_exporter test <tests.yaml>...\n")
+		return 2
+	}
+
+	// exporter's own metrics are not tested
+	collector.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+	webhook.InitMetrics(prometheus.NewRegistry(), exporterNamespace)
+
+	code := 0
+	for _, path := range args {
+		fmt.Printf("Unit Testing: %s\n", path)
+		failures, err := runTestFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  FAILED: unable to run tests err:%s\n", err)
+			code = 1
+			continue
+		}
+		if len(failures) == 0 {
+			fmt.Printf("  SUCCESS\n")
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  FAILED:\n")
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "%s\n", f)
+		}
+		code = 1
+	}
+	return code
+}
+
+// runTestFile runs all the tests of the file and returns their failures
+func runTestFile(path string) ([]string, error) {
+	var tf testFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, &tf); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	configPath := tf.Config
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(dir, configPath)
+	}
+
+	var failures []string
+	for i, tc := range tf.Tests {
+		name := tc.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		errs, err := tc.run(configPath, dir)
+		if err != nil {
+			return nil, fmt.Errorf("test:%s err:%w", name, err)
+		}
+		for _, e := range errs {
+			failures = append(failures, fmt.Sprintf("    test:%s %s", name, e))
+		}
+	}
+	return failures, nil
+}
+
+// run sends the requests to the webhooks of the config and compares the
+// series of the metrics. collectors and metrics are created for every test.
+func (tc testCase) run(configPath, dir string) ([]string, error) {
+	log := commandLogger(os.Stderr)
+
+	reg := prometheus.NewRegistry()
+	collectors, err := collector.Load(configPath, reg, log, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	collectorInputs := make(map[string]webhook.Input)
+	for id, c := range collectors {
+		collectorInputs[id] = syncInput{c}
+	}
+
+	webhooks, err := webhook.Load(configPath, log, collectorInputs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	for _, wh := range webhooks {
+		mux.Handle(wh.Path, wh)
+	}
+
+	var failures []string
+	for i, tr := range tc.Requests {
+		body, err := tr.body(dir)
+		if err != nil {
+			return nil, fmt.Errorf("request:%d err:%w", i, err)
+		}
+
+		method := tr.Method
+		if method == "" {
+			method = http.MethodPost
+		}
+		r := httptest.NewRequest(method, tr.Path, body)
+		for k, v := range tr.Headers {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if tr.ExpectedStatus != 0 && w.Code != tr.ExpectedStatus {
+			failures = append(failures, fmt.Sprintf("request:%d path:%s status mismatch want:%d got:%d",
+				i, tr.Path, tr.ExpectedStatus, w.Code))
+		}
+	}
+
+	gathering, err := reg.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("unable to gather metrics err:%w", err)
+	}
+	var sb strings.Builder
+	for _, mf := range gathering {
+		if _, err := expfmt.MetricFamilyToText(&sb, mf); err != nil {
+			return nil, fmt.Errorf("unable to encode metrics err:%w", err)
+		}
+	}
+
+	got, err := seriesLines(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse metrics err:%w", err)
+	}
+	want, err := seriesLines(tc.ExpectedMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse expected metrics err:%w", err)
+	}
+
+	if diff := seriesDiff(want, got); diff != "" {
+		failures = append(failures, fmt.Sprintf("metrics mismatch (-want +got):\n%s", diff))
+	}
+	return failures, nil
+}
+
+func (tr testRequest) body(dir string) (io.Reader, error) {
+	if tr.BodyFile == "" {
+		return strings.NewReader(tr.Body), nil
+	}
+	if tr.Body != "" {
+		return nil, fmt.Errorf("only one of body or bodyFile can be set")
+	}
+	path := tr.BodyFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(string(data)), nil
+}
+
+// seriesLines parses the text format and returns sorted series with sorted
+// labels, so that formatting of expected metrics doesn't need to match the
+// exposition. all the samples are parsed as untyped without comments.
+func seriesLines(text string) ([]string, error) {
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(strings.NewReader(commentLineReg.ReplaceAllString(text, "")))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			lines = append(lines, seriesLine(mf.GetName(), m))
+		}
+	}
+	slices.Sort(lines)
+	return lines, nil
+}
+
+func seriesLine(name string, m *dto.Metric) string {
+	labels := make(map[string]string)
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		var pairs []string
+		for _, n := range slices.Sorted(maps.Keys(labels)) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", n, labels[n]))
+		}
+		sb.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	sb.WriteString(" " + strconv.FormatFloat(m.GetUntyped().GetValue(), 'g', -1, 64))
+	if m.TimestampMs != nil {
+		sb.WriteString(" " + strconv.FormatInt(m.GetTimestampMs(), 10))
+	}
+	return sb.String()
+}
+
+// seriesDiff returns missing series prefixed with '-' and unexpected series
+// prefixed with '+', series are counted so that duplicates are reported.
+func seriesDiff(want, got []string) string {
+	counts := make(map[string]int)
+	for _, l := range want {
+		counts[l]++
+	}
+	for _, l := range got {
+		counts[l]--
+	}
+	lines := slices.Sorted(maps.Keys(counts))
+
+	var sb strings.Builder
+	for _, l := range lines {
+		for range counts[l] {
+			sb.WriteString("      - " + l + "\n")
+		}
+	}
+	for _, l := range lines {
+		for range -counts[l] {
+			sb.WriteString("      + " + l + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_seriesLines(t *testing.T) {
+	text := `
+# HELP animal_population population
+# TYPE animal_population gauge
+animal_population{predator="true",name="lion"} 124
+animal_population{name="deer", predator="false"} 4.56e+02
+  # comments are ignored
+event_time{id="1"} 1 1700000000000
+`
+	got, err := seriesLines(text)
+	if err != nil {
+		t.Fatalf("seriesLines() error = %v", err)
+	}
+	want := []string{
+		`animal_population{name="deer",predator="false"} 456`,
+		`animal_population{name="lion",predator="true"} 124`,
+		`event_time{id="1"} 1 1700000000000`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("seriesLines() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_seriesDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+		got  []string
+		diff string
+	}{
+		{"equal", []string{"a 1", "b 1"}, []string{"a 1", "b 1"}, ""},
+		{"mismatch", []string{"a 1", "b 1"}, []string{"a 2", "b 1"}, "      - a 1\n      + a 2"},
+		{"missing", []string{"a 1", "b 1"}, []string{"b 1"}, "      - a 1"},
+		{"unexpected", nil, []string{"a 1"}, "      + a 1"},
+		{"duplicate-got", []string{"a 1"}, []string{"a 1", "a 1"}, "      + a 1"},
+		{"duplicate-want", []string{"a 1", "a 1"}, []string{"a 1"}, "      - a 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.diff, seriesDiff(tt.want, tt.got)); diff != "" {
+				t.Errorf("seriesDiff() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_runTestFile(t *testing.T) {
+	t.Setenv("TEST_SHARED_WEB_HOOK_KEY", "secret")
+
+	// tests of the test config must pass
+	failures, err := runTestFile("test/config-tests.yaml")
+	if err != nil {
+		t.Fatalf("runTestFile() error = %v", err)
+	}
+	if len(failures) > 0 {
+		t.Errorf("runTestFile() failures:\n%s", strings.Join(failures, "\n"))
+	}
+}
+
+func Test_runTestFile_failed(t *testing.T) {
+	t.Setenv("TEST_SHARED_WEB_HOOK_KEY", "secret")
+
+	// absolute paths are not relative to the test file
+	config, err := filepath.Abs("test/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := filepath.Abs("test/animal-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := `
+config: ` + config + `
+tests:
+  - name: animals
+    requests:
+      - path: /animals
+        bodyFile: ` + body + `
+        expectedStatus: 200
+    expectedMetrics: |
+      animal_population{name="deer",predator="false"} 456
+      animal_population{name="lion",predator="true"} 125
+      animal_population{name="pigeon",predator="false"} 789
+`
+	path := filepath.Join(t.TempDir(), "tests.yaml")
+	if err := os.WriteFile(path, []byte(tests), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := runTestFile(path)
+	if err != nil {
+		t.Fatalf("runTestFile() error = %v", err)
+	}
+	want := []string{
+		"    test:animals request:0 path:/animals status mismatch want:200 got:204",
+		"    test:animals metrics mismatch (-want +got):\n" +
+			`      - animal_population{name="lion",predator="true"} 125` + "\n" +
+			`      + animal_population{name="lion",predator="true"} 123`,
+	}
+	if diff := cmp.Diff(want, failures); diff != "" {
+		t.Errorf("runTestFile() mismatch (-want +got):\n%s", diff)
+	}
+}
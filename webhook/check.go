@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/utilitywarehouse/json_exporter/jq"
+	"gopkg.in/yaml.v2"
+)
+
+// CheckConfig validates the webhooks of the config and compiles all of their
+// jq expressions, collectors are the ids of the collectors of the config.
+// unlike Load it doesn't stop at the first error, all the errors found are
+// returned.
+func CheckConfig(configPath string, collectors []string) []error {
+	var config Config
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return []error{err}
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return []error{err}
+	}
+
+	errs := configErrors(config)
+
+	// expressions are only checked if definitions and variables are valid,
+	// variables whose values can't be read are reported and a placeholder is used
+	jqc, jqErrs := jq.CheckCompiler(config.JQ, config.Variables, filepath.Dir(configPath))
+	for _, err := range jqErrs {
+		errs = append(errs, fmt.Errorf("invalid jq config err:%w", err))
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(config.WebHooks)) {
+		wh := config.WebHooks[id]
+		if wh == nil {
+			continue
+		}
+		for _, c := range wh.Collectors {
+			if !slices.Contains(collectors, c.ID) {
+				errs = append(errs, fmt.Errorf("unknown collector webhook:%s collector:%s", id, c.ID))
+			}
+		}
+		if jqc == nil {
+			continue
+		}
+		for _, c := range wh.Collectors {
+			if _, err := jqc.Compile(c.Transform); err != nil {
+				errs = append(errs, fmt.Errorf("invalid jq expression webhook:%s location:collectors[%s].transform err:%w", id, c.ID, err))
+			}
+		}
+		if wh.Dedup != nil && wh.Dedup.Key != "" {
+			if _, err := jqc.Compile(wh.Dedup.Key); err != nil {
+				errs = append(errs, fmt.Errorf("invalid jq expression webhook:%s location:dedup.key err:%w", id, err))
+			}
+		}
+	}
+
+	return errs
+}
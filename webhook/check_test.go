@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	// env variables of the deployment are not set when config is checked in CI
+	config := `
+variables:
+  - name: key
+    valueFromEnv: TEST_CHECK_UNSET
+webhooks:
+  a:
+    path: /events
+    collectors:
+      - id: example
+        transform: .events[] | select(.key == $key)
+      - id: missing
+        transform: .events[
+  b:
+    path: /events
+    dedup:
+      key: .id |
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("unable to write config err:%v", err)
+	}
+
+	var got []string
+	for _, err := range CheckConfig(path, []string{"example"}) {
+		got = append(got, err.Error())
+	}
+	expected := []string{
+		`webhooks path must be unique duplicate found webhook:b path:/events`,
+		`invalid jq config err:unable to get value of variable:key err:env variable not set env:TEST_CHECK_UNSET`,
+		`unknown collector webhook:a collector:missing`,
+		`invalid jq expression webhook:a location:collectors[missing].transform err:jq query parse error unexpected EOF`,
+		`invalid jq expression webhook:b location:dedup.key err:jq query parse error unexpected EOF`,
+	}
+	if diff := cmp.Diff(got, expected); diff != "" {
+		t.Errorf("CheckConfig() errors mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -1,20 +1,29 @@
 package webhook
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 
-	"github.com/itchyny/gojq"
+	"github.com/utilitywarehouse/json_exporter/dedup"
+	"github.com/utilitywarehouse/json_exporter/jq"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	WebHooks map[string]*WebHook `yaml:"webhooks"`
+	JQ jq.Config `yaml:"jq"`
+	// Variables are exposed as $name to all the jq expressions
+	Variables []jq.Variable       `yaml:"variables"`
+	WebHooks  map[string]*WebHook `yaml:"webhooks"`
 }
 
 type WebHook struct {
-	id     string
+	id string
+	// jq compiles the expressions with the definitions and modules of the config
+	jq     *jq.Compiler
 	Method string `yaml:"method"`
 	Path   string `yaml:"path"`
 	Auth   struct {
@@ -26,12 +35,14 @@ type WebHook struct {
 		Code    int      `yaml:"code"`
 	} `yaml:"response"`
 	Collectors []Collector `yaml:"collectors"`
+	// Dedup skips the payloads already received by the webhook
+	Dedup *dedup.Config `yaml:"dedup"`
 }
 
 type Collector struct {
 	ID            string `yaml:"id"`
 	Transform     string `yaml:"transform"`
-	transformCode *gojq.Code
+	transformCode *jq.Code
 }
 
 type Header struct {
@@ -47,56 +58,69 @@ func (h Header) GetValue() string {
 	return os.Getenv(h.ValueFromEnv)
 }
 
-func loadConfig(configPath string) (map[string]*WebHook, error) {
+// compiler returns jq compiler of the webhook
+func (wh *WebHook) compiler() *jq.Compiler {
+	if wh.jq == nil {
+		return &jq.Compiler{}
+	}
+	return wh.jq
+}
+
+// loadConfig parses the config, dir is the directory of the config file
+func loadConfig(data []byte, dir string) (map[string]*WebHook, error) {
 	var config Config
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
+	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	jqc, err := jq.NewCompiler(config.JQ, config.Variables, dir)
+	if err != nil {
 		return nil, err
 	}
 
 	for id, webhook := range config.WebHooks {
-		webhook.id = id
+		if webhook != nil {
+			webhook.id = id
+			webhook.jq = jqc
+		}
 	}
 
 	return config.WebHooks, validateConfig(config)
 }
 
 func validateConfig(config Config) error {
+	return errors.Join(configErrors(config)...)
+}
+
+// configErrors returns all the errors of the config, webhooks are validated
+// in the order of their ids
+func configErrors(config Config) []error {
+	var errs []error
+
 	// webhook path must be unique
 	paths := make(map[string]bool)
-	for id, wh := range config.WebHooks {
-		if wh.Path == "" {
-			return fmt.Errorf("empty path not allowed webhook:%s", id)
+	for _, id := range slices.Sorted(maps.Keys(config.WebHooks)) {
+		wh := config.WebHooks[id]
+		if wh == nil {
+			errs = append(errs, fmt.Errorf("empty webhook config webhook:%s", id))
+			continue
 		}
-		if !strings.HasPrefix(wh.Path, "/") {
-			return fmt.Errorf("path should have '/' prefix webhook:%s", id)
+		if wh.Path == "" {
+			errs = append(errs, fmt.Errorf("empty path not allowed webhook:%s", id))
+		} else if !strings.HasPrefix(wh.Path, "/") {
+			errs = append(errs, fmt.Errorf("path should have '/' prefix webhook:%s", id))
 		}
-		if _, ok := paths[wh.Path]; ok {
-			return fmt.Errorf("webhooks path must be unique duplicate found webhook:%s path:%s", id, wh.Path)
+		if _, ok := paths[wh.Path]; ok && wh.Path != "" {
+			errs = append(errs, fmt.Errorf("webhooks path must be unique duplicate found webhook:%s path:%s", id, wh.Path))
 		}
 		paths[wh.Path] = true
-	}
-	return nil
-}
 
-func parseAndCompileJQExp(exp string) (*gojq.Code, error) {
-	if exp == "" {
-		exp = "."
-	}
-	query, err := gojq.Parse(exp)
-	if err != nil {
-		return nil, fmt.Errorf("jq query parse error %w", err)
-	}
-
-	code, err := gojq.Compile(query)
-	if err != nil {
-		return nil, fmt.Errorf("jq query compile error %w", err)
+		if wh.Dedup != nil {
+			if err := wh.Dedup.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("invalid dedup config webhook:%s err:%w", id, err))
+			}
+		}
 	}
-
-	return code, nil
+	return errs
 }
@@ -1,6 +1,17 @@
 package webhook
 
-import "testing"
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/dedup"
+)
 
 func Test_validateConfig(t *testing.T) {
 	type args struct {
@@ -42,6 +53,20 @@ func Test_validateConfig(t *testing.T) {
 			}}},
 			true,
 		},
+		{
+			"dedup",
+			args{Config{WebHooks: map[string]*WebHook{
+				"test1": {Path: "/wh", Dedup: &dedup.Config{Key: ".uuid"}},
+			}}},
+			false,
+		},
+		{
+			"dedup_without_key",
+			args{Config{WebHooks: map[string]*WebHook{
+				"test1": {Path: "/wh", Dedup: &dedup.Config{TTL: time.Hour}},
+			}}},
+			true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -51,3 +76,111 @@ func Test_validateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad_jq(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "events.jq"), []byte(`def events: .data.events[];`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := `
+jq:
+  definitions: |
+    def login_events: select(.type == "login");
+  libraryPaths:
+    - .
+webhooks:
+  example:
+    method: POST
+    path: /events
+    collectors:
+      - id: example
+        transform: 'include "events"; events | login_events | .user'
+`
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	example := make(chanInput, 10)
+	webhooks, err := Load(path, slog.Default(), map[string]Input{"example": example}, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	payload := map[string]any{"data": map[string]any{"events": []any{
+		map[string]any{"type": "login", "user": "a"},
+		map[string]any{"type": "logout", "user": "a"},
+		map[string]any{"type": "login", "user": "b"},
+	}}}
+	if err := webhooks["example"].Process(context.Background(), payload); err != nil {
+		t.Fatalf("WebHookHandler.Process() error = %v", err)
+	}
+	close(example)
+
+	var got []any
+	for input := range example {
+		got = append(got, input)
+	}
+	if diff := cmp.Diff([]any{"a", "b"}, got); diff != "" {
+		t.Errorf("WebHookHandler.Process() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoad_reuseDedup(t *testing.T) {
+	InitMetrics(prometheus.NewPedanticRegistry(), "test_json")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig := func(key string) {
+		config := `
+webhooks:
+  unchanged:
+    method: POST
+    path: /unchanged
+    dedup:
+      key: .id
+    collectors:
+      - id: example
+  changed:
+    method: POST
+    path: /changed
+    dedup:
+      key: ` + key + `
+    collectors:
+      - id: example
+`
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collectorInputs := map[string]Input{"example": make(chanInput, 10)}
+	ctx := context.Background()
+	payload := map[string]any{"id": "1", "event_id": "1"}
+
+	writeConfig(".id")
+	previous, err := Load(path, slog.Default(), collectorInputs, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for id, wh := range previous {
+		if _, dup := wh.isDuplicate(ctx, payload); dup {
+			t.Fatalf("WebHookHandler.isDuplicate() webhook:%s = true, want false", id)
+		}
+	}
+
+	writeConfig(".event_id")
+	webhooks, err := Load(path, slog.Default(), collectorInputs, previous)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// received keys are only kept by the webhook with unchanged dedup config
+	want := map[string]bool{"unchanged": true, "changed": false}
+	got := make(map[string]bool)
+	for id, wh := range webhooks {
+		_, got[id] = wh.isDuplicate(ctx, payload)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WebHookHandler.isDuplicate() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -3,10 +3,12 @@ package webhook
 import "github.com/prometheus/client_golang/prometheus"
 
 var (
-	pcRequests *prometheus.CounterVec
+	pcRequests    *prometheus.CounterVec
+	pcDedupHits   *prometheus.CounterVec
+	pcDedupMisses *prometheus.CounterVec
 )
 
-func initMetrics(reg *prometheus.Registry, exporterNamespace string) {
+func InitMetrics(reg *prometheus.Registry, exporterNamespace string) {
 
 	pcRequests = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -17,5 +19,23 @@ func initMetrics(reg *prometheus.Registry, exporterNamespace string) {
 		[]string{"webhook", "status"},
 	)
 
-	reg.MustRegister(pcRequests)
+	pcDedupHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: exporterNamespace,
+			Name:      "webhook_dedup_hits_total",
+			Help:      "The total number of payloads skipped because their dedup key was already seen",
+		},
+		[]string{"webhook"},
+	)
+
+	pcDedupMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: exporterNamespace,
+			Name:      "webhook_dedup_misses_total",
+			Help:      "The total number of payloads processed because their dedup key was not seen",
+		},
+		[]string{"webhook"},
+	)
+
+	reg.MustRegister(pcRequests, pcDedupHits, pcDedupMisses)
 }
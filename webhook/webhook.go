@@ -1,40 +1,84 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/utilitywarehouse/json_exporter/dedup"
 )
 
 type WebHookHandler struct {
 	*WebHook
 	log        *slog.Logger
-	collectors map[string]chan any
+	collectors map[string]Input
+	// dedup is only set if payloads of the webhook are deduplicated
+	dedup *dedup.Deduplicator
+	// dedupFingerprint is the config of dedup, used to reuse dedup on reload
+	dedupFingerprint string
+}
+
+// Input is the input queue of a collector
+type Input interface {
+	// Send adds input to the queue, it returns an error if input is not accepted
+	Send(ctx context.Context, input any) error
+}
+
+// capacityChecker is implemented by the Inputs which may reject inputs, Accepts
+// returns the error Send would return if n inputs can't be queued
+type capacityChecker interface {
+	Accepts(n int) error
+}
+
+// statusCoder is implemented by the errors of the Input which should be
+// responded with a specific status code
+type statusCoder interface {
+	StatusCode() int
 }
 
 func New(
 	configPath string,
 	reg *prometheus.Registry,
 	log *slog.Logger,
-	collectorInputs map[string]chan any,
+	collectorInputs map[string]Input,
 	exporterNamespace string,
 ) (map[string]*WebHookHandler, error) {
 
-	initMetrics(reg, exporterNamespace)
+	InitMetrics(reg, exporterNamespace)
+
+	return Load(configPath, log, collectorInputs, nil)
+}
+
+// Load loads the webhooks of the config, exporter's own metrics must be
+// initialised with InitMetrics. dedup state of the previous webhooks whose
+// dedup config is unchanged is reused.
+func Load(configPath string, log *slog.Logger, collectorInputs map[string]Input, previous map[string]*WebHookHandler) (map[string]*WebHookHandler, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load webhook config err:%w", err)
+	}
+	return LoadData(data, filepath.Dir(configPath), log, collectorInputs, previous)
+}
 
-	webhooks, err := loadConfig(configPath)
+// LoadData is like Load but it loads the webhooks of the config content, dir
+// is the directory of the config file.
+func LoadData(data []byte, dir string, log *slog.Logger, collectorInputs map[string]Input, previous map[string]*WebHookHandler) (map[string]*WebHookHandler, error) {
+	webhooks, err := loadConfig(data, dir)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load webhook config err:%w", err)
 	}
 
 	handlers := make(map[string]*WebHookHandler)
 	for id, wh := range webhooks {
-		h, err := webHookHandler(log, wh, collectorInputs)
+		h, err := webHookHandler(log, wh, collectorInputs, previous[id])
 		if err != nil {
 			return nil, fmt.Errorf("unable to create webhook id:%s err:%w", id, err)
 		}
@@ -43,22 +87,40 @@ func New(
 	return handlers, nil
 }
 
-func webHookHandler(log *slog.Logger, wh *WebHook, collectorInputs map[string]chan any) (*WebHookHandler, error) {
+func webHookHandler(log *slog.Logger, wh *WebHook, collectorInputs map[string]Input, previous *WebHookHandler) (*WebHookHandler, error) {
 	var err error
 	h := &WebHookHandler{
 		WebHook: wh,
 		log:     log.With("webhook", wh.id),
 	}
 
-	h.collectors = make(map[string]chan any)
+	h.collectors = make(map[string]Input)
 
 	for i := range wh.Collectors {
-		h.collectors[wh.Collectors[i].ID] = collectorInputs[wh.Collectors[i].ID]
-		wh.Collectors[i].transformCode, err = parseAndCompileJQExp(wh.Collectors[i].Transform)
+		input, ok := collectorInputs[wh.Collectors[i].ID]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector id:%s", wh.Collectors[i].ID)
+		}
+		h.collectors[wh.Collectors[i].ID] = input
+		wh.Collectors[i].transformCode, err = wh.compiler().Compile(wh.Collectors[i].Transform)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse transform code collector:%s err:%w", wh.Collectors[i].ID, err)
+		}
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse transform code err:%w", err)
+	if wh.Dedup != nil {
+		h.dedupFingerprint = dedup.Fingerprint(*wh.Dedup, wh.compiler())
+		// received keys are kept on reload if dedup config is unchanged
+		if previous != nil && previous.dedup != nil && h.dedupFingerprint != "" &&
+			previous.dedupFingerprint == h.dedupFingerprint {
+			h.dedup = previous.dedup
+		} else {
+			code, err := wh.compiler().Compile(wh.Dedup.Key)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse dedup key code err:%w", err)
+			}
+			h.dedup = dedup.New(*wh.Dedup, code)
+		}
 	}
 
 	// defaults
@@ -98,9 +160,43 @@ func (wh *WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// run transform code and send result to collector
-	for _, c := range wh.Collectors {
-		iter := c.transformCode.RunWithContext(r.Context(), payload)
+	// duplicate payloads are responded as success so that sender stops retrying
+	key, duplicate := wh.isDuplicate(r.Context(), payload)
+	if duplicate {
+		wh.log.Debug("duplicate payload skipped")
+		wh.respond(w)
+		return
+	}
+
+	if err := wh.Process(r.Context(), payload); err != nil {
+		// payload is not accepted so its retry must not be skipped
+		if key != "" {
+			wh.dedup.Forget(key)
+		}
+		code := http.StatusServiceUnavailable
+		var sc statusCoder
+		if errors.As(err, &sc) {
+			code = sc.StatusCode()
+		}
+		w.WriteHeader(code)
+		pcRequests.WithLabelValues(wh.id, strconv.Itoa(code)).Inc()
+		return
+	}
+
+	wh.respond(w)
+}
+
+// Process runs transform code of the collectors on the payload and sends the
+// results to the collectors. transform errors are logged and rest of the
+// results of the collector are skipped, it returns error if collector
+// doesn't accept the result. results are only sent once all the collectors
+// can accept them, so that a rejected payload isn't partially processed and
+// then counted twice when retried.
+func (wh *WebHookHandler) Process(ctx context.Context, payload any) error {
+	results := make([][]any, len(wh.Collectors))
+	counts := make(map[string]int)
+	for i, c := range wh.Collectors {
+		iter := c.transformCode.RunWithContext(ctx, payload)
 		for {
 			object, ok := iter.Next()
 			if !ok {
@@ -108,14 +204,37 @@ func (wh *WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			if err, ok := object.(error); ok {
-				wh.log.Error("unable to transform", "err", err)
+				wh.log.Error("unable to transform", "collector", c.ID, "err", err)
 				// todo: should we send 500 to server?
 				break
 			}
-			wh.collectors[c.ID] <- object
+			results[i] = append(results[i], object)
+		}
+		counts[c.ID] += len(results[i])
+	}
+
+	for id, n := range counts {
+		if cc, ok := wh.collectors[id].(capacityChecker); ok && n > 0 {
+			if err := cc.Accepts(n); err != nil {
+				wh.log.Error("unable to send payload to collector", "collector", id, "err", err)
+				return err
+			}
 		}
 	}
 
+	for i, c := range wh.Collectors {
+		for _, object := range results[i] {
+			if err := wh.collectors[c.ID].Send(ctx, object); err != nil {
+				wh.log.Error("unable to send payload to collector", "collector", c.ID, "err", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// respond writes the configured response of the webhook
+func (wh *WebHookHandler) respond(w http.ResponseWriter) {
 	for _, h := range wh.Response.Headers {
 		w.Header().Set(h.Name, h.GetValue())
 	}
@@ -124,6 +243,31 @@ func (wh *WebHookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	pcRequests.WithLabelValues(wh.id, strconv.Itoa(wh.Response.Code)).Inc()
 }
 
+// isDuplicate returns true if payload was already received by the webhook,
+// otherwise dedup key of the payload is recorded and returned. payloads are
+// processed if dedup key can't be extracted.
+func (wh *WebHookHandler) isDuplicate(ctx context.Context, payload any) (string, bool) {
+	if wh.dedup == nil {
+		return "", false
+	}
+
+	key, ok, err := wh.dedup.Key(ctx, payload)
+	if err != nil {
+		wh.log.Warn("unable to deduplicate payload", "err", err)
+		return "", false
+	}
+	if !ok {
+		return "", false
+	}
+
+	if wh.dedup.SeenKey(key) {
+		pcDedupHits.WithLabelValues(wh.id).Inc()
+		return "", true
+	}
+	pcDedupMisses.WithLabelValues(wh.id).Inc()
+	return key, false
+}
+
 func isAuthHeadersMatching(reqHeaders http.Header, expected []Header) bool {
 	verified := true
 
@@ -1,17 +1,23 @@
 package webhook
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/utilitywarehouse/json_exporter/collector"
+	"github.com/utilitywarehouse/json_exporter/dedup"
 )
 
 func TestWebHookHandler_ServeHTTP(t *testing.T) {
@@ -20,16 +26,16 @@ func TestWebHookHandler_ServeHTTP(t *testing.T) {
 
 	os.Setenv("TEST_SHARED_WEB_HOOK_KEY", "test-shared-key")
 
-	collectorInputs := make(map[string]chan any)
-	collectorInputs["example"] = make(chan any)
-	collectorInputs["animals"] = make(chan any)
+	example := make(chanInput)
+	animals := make(chanInput)
+	collectorInputs := map[string]Input{"example": example, "animals": animals}
 
 	go func() {
 		for {
 			select {
-			case input := <-collectorInputs["example"]:
+			case input := <-example:
 				fmt.Println(input)
-			case input := <-collectorInputs["animals"]:
+			case input := <-animals:
 				t.Errorf("input received on wrong channel input %s", input)
 			}
 		}
@@ -100,16 +106,268 @@ func TestWebHookHandler_ServeHTTP(t *testing.T) {
 	}
 }
 
+func TestWebHookHandler_ServeHTTP_SendError(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	log := slog.Default()
+
+	InitMetrics(reg, "test_json")
+
+	tests := []struct {
+		name      string
+		err       error
+		respSatus int
+	}{
+		{"accepted", nil, 200},
+		{"rejected", &rejectError{http.StatusTooManyRequests}, 429},
+		{"rejected-unavailable", &rejectError{http.StatusServiceUnavailable}, 503},
+		{"other-error", context.Canceled, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := &WebHook{
+				id:         "example",
+				Method:     "POST",
+				Path:       "/",
+				Collectors: []Collector{{ID: "example"}},
+			}
+
+			webhook, err := webHookHandler(log, wh, map[string]Input{"example": errInput{tt.err}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest("POST", "/", strings.NewReader(`{"something":"some"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			webhook.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.respSatus {
+				t.Errorf("ServeHTTP() handler returned wrong status code: got %v want %v",
+					status, tt.respSatus)
+			}
+		})
+	}
+}
+
+func TestWebHookHandler_ServeHTTP_Dedup(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	log := slog.Default()
+
+	InitMetrics(reg, "test_json")
+
+	example := make(chanInput, 10)
+
+	wh := &WebHook{
+		id:         "example",
+		Method:     "POST",
+		Path:       "/",
+		Collectors: []Collector{{ID: "example"}},
+		Dedup:      &dedup.Config{Key: ".uuid", TTL: time.Hour},
+	}
+	wh.Response.Code = 204
+
+	webhook, err := webHookHandler(log, wh, map[string]Input{"example": example}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{
+		`{"uuid": "1"}`,
+		// retried delivery
+		`{"uuid": "1"}`,
+		`{"uuid": "2"}`,
+		`{"other": "3"}`,
+	} {
+		req, err := http.NewRequest("POST", "/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		webhook.ServeHTTP(rr, req)
+
+		if rr.Code != 204 {
+			t.Errorf("ServeHTTP() handler returned wrong status code: got %v want %v", rr.Code, 204)
+		}
+	}
+
+	close(example)
+	var got []any
+	for input := range example {
+		got = append(got, input)
+	}
+	want := []any{
+		map[string]any{"uuid": "1"},
+		map[string]any{"uuid": "2"},
+		map[string]any{"other": "3"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("ServeHTTP() inputs mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := testutil.ToFloat64(pcDedupHits.WithLabelValues("example")); got != 1 {
+		t.Errorf("webhook_dedup_hits_total = %v, want %v", got, 1)
+	}
+	if got := testutil.ToFloat64(pcDedupMisses.WithLabelValues("example")); got != 2 {
+		t.Errorf("webhook_dedup_misses_total = %v, want %v", got, 2)
+	}
+}
+
+func TestWebHookHandler_ServeHTTP_DedupReject(t *testing.T) {
+	log := slog.Default()
+
+	InitMetrics(prometheus.NewPedanticRegistry(), "test_json")
+	collector.InitMetrics(prometheus.NewPedanticRegistry(), "test_json")
+
+	config := `
+collectors:
+  example:
+    queue:
+      size: 1
+      policy: reject
+      rejectStatusCode: 429
+    metrics:
+      - name: events_total
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	collectors, err := collector.Load(path, prometheus.NewPedanticRegistry(), log, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	example := collectors["example"]
+
+	wh := &WebHook{
+		id:         "example",
+		Method:     "POST",
+		Path:       "/",
+		Collectors: []Collector{{ID: "example"}},
+		Dedup:      &dedup.Config{Key: ".uuid", TTL: time.Hour},
+	}
+	webhook, err := webHookHandler(log, wh, map[string]Input{"example": example}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// collector is not started so its queue is only drained by the test
+	for _, tt := range []struct {
+		body  string
+		drain bool
+		want  int
+	}{
+		{`{"uuid": "1"}`, false, 200},
+		// queue is full
+		{`{"uuid": "2"}`, false, 429},
+		// retry of rejected payload is not a duplicate
+		{`{"uuid": "2"}`, false, 429},
+		{`{"uuid": "2"}`, true, 200},
+		// retry of accepted payload is a duplicate
+		{`{"uuid": "2"}`, false, 200},
+	} {
+		if tt.drain {
+			<-example.Input
+		}
+		req, err := http.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		webhook.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("ServeHTTP() handler returned wrong status code body:%s got %v want %v", tt.body, rr.Code, tt.want)
+		}
+	}
+
+	if got := len(example.Input); got != 1 {
+		t.Errorf("collector queue length = %v, want %v", got, 1)
+	}
+	if got := testutil.ToFloat64(pcDedupHits.WithLabelValues("example")); got != 1 {
+		t.Errorf("webhook_dedup_hits_total = %v, want %v", got, 1)
+	}
+}
+
+func TestWebHookHandler_Process_reject(t *testing.T) {
+	log := slog.Default()
+
+	InitMetrics(prometheus.NewPedanticRegistry(), "test_json")
+	collector.InitMetrics(prometheus.NewPedanticRegistry(), "test_json")
+
+	config := `
+collectors:
+  large:
+    queue:
+      size: 10
+      policy: reject
+    metrics:
+      - name: events_total
+  small:
+    queue:
+      size: 2
+      policy: reject
+    metrics:
+      - name: small_events_total
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	collectors, err := collector.Load(path, prometheus.NewPedanticRegistry(), log, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wh := &WebHook{
+		id:     "example",
+		Method: "POST",
+		Path:   "/",
+		Collectors: []Collector{
+			{ID: "large", Transform: ".events[]"},
+			{ID: "small", Transform: ".events[]"},
+		},
+	}
+	inputs := map[string]Input{"large": collectors["large"], "small": collectors["small"]}
+	webhook, err := webHookHandler(log, wh, inputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// collectors are not started so their queues are only drained by the test
+	payload := map[string]any{"events": []any{1.0, 2.0}}
+	if err := webhook.Process(context.Background(), payload); err != nil {
+		t.Fatalf("WebHookHandler.Process() error = %v", err)
+	}
+	<-collectors["small"].Input
+
+	// small collector can't take all the objects of the payload so none of
+	// them are sent to either collector
+	var qErr *collector.QueueFullError
+	if err := webhook.Process(context.Background(), payload); !errors.As(err, &qErr) {
+		t.Fatalf("WebHookHandler.Process() error = %v, want queue full error", err)
+	}
+	if qErr.Collector != "small" {
+		t.Errorf("WebHookHandler.Process() rejected by collector:%s, want small", qErr.Collector)
+	}
+	for id, want := range map[string]int{"large": 2, "small": 1} {
+		if got := len(collectors[id].Input); got != want {
+			t.Errorf("collector:%s queue length = %v, want %v", id, got, want)
+		}
+	}
+}
+
 func TestWebHookHandler_ServeHTTP_Transform(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	log := slog.Default()
 
-	initMetrics(reg, "test_json")
+	InitMetrics(reg, "test_json")
 
 	os.Setenv("TEST_SHARED_WEB_HOOK_KEY", "test-shared-key")
 
-	collectorInputs := make(map[string]chan any)
-	collectorInputs["example"] = make(chan any)
+	example := make(chanInput)
+	collectorInputs := map[string]Input{"example": example}
 
 	type args struct {
 		transform string
@@ -162,6 +420,18 @@ func TestWebHookHandler_ServeHTTP_Transform(t *testing.T) {
 			}`},
 			map[string]any{"count": float64(2), "id": "id-A"},
 		},
+		{
+			"custom-functions",
+			args{
+				`{id: (.ref | regex_extract("id=(\\d+)")), hash: (.user | sha256), published: (.published | parse_rfc3339)}`,
+				`{"ref": "source id=42", "user": "abc", "published": "2020-12-11T01:00:52.5Z"}`,
+			},
+			map[string]any{
+				"id":        "42",
+				"hash":      "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+				"published": 1607648452.5,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -173,7 +443,7 @@ func TestWebHookHandler_ServeHTTP_Transform(t *testing.T) {
 				Collectors: []Collector{{ID: "example", Transform: tt.args.transform}},
 			}
 
-			webhook, err := webHookHandler(log, wh, collectorInputs)
+			webhook, err := webHookHandler(log, wh, collectorInputs, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -186,7 +456,7 @@ func TestWebHookHandler_ServeHTTP_Transform(t *testing.T) {
 
 			go webhook.ServeHTTP(rr, req)
 
-			input := <-collectorInputs["example"]
+			input := <-example
 
 			if diff := cmp.Diff(input, tt.output); diff != "" {
 				t.Errorf("TestWebHookHandler_ServeHTTP_Transform transform mismatch (-want +got):\n%s", diff)
@@ -256,3 +526,31 @@ func Test_isAuthHeadersMatching(t *testing.T) {
 		})
 	}
 }
+
+// chanInput sends all the inputs to the channel
+type chanInput chan any
+
+func (c chanInput) Send(ctx context.Context, input any) error {
+	select {
+	case c <- input:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errInput returns err for all the inputs
+type errInput struct {
+	err error
+}
+
+func (e errInput) Send(context.Context, any) error {
+	return e.err
+}
+
+type rejectError struct {
+	code int
+}
+
+func (e *rejectError) Error() string   { return "rejected" }
+func (e *rejectError) StatusCode() int { return e.code }